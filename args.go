@@ -0,0 +1,489 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+type argKind int
+
+const (
+	// argString is a single word, or several words wrapped in quotes
+	argString argKind = iota
+	// argText swallows the rest of the message as is, so it has to be last
+	argText
+	argUser
+	argChannel
+	argRole
+	argInt
+	argDuration
+	// argFlag is a boolean set by passing --name
+	argFlag
+	// argAttachment is a file uploaded with the command, for messages it's
+	// every file attached to the message rather than a positional argument
+	argAttachment
+)
+
+type commandArg struct {
+	name         string
+	description  string
+	kind         argKind
+	required     bool
+	autocomplete bool
+}
+
+// commandArgs holds the parsed and validated arguments of a command
+// invocation, keyed by the name of the commandArg they belong to.
+type commandArgs struct {
+	values map[string]interface{}
+}
+
+var (
+	userMentionRegex    = regexp.MustCompile(`^<@!?(\d+)>$`)
+	channelMentionRegex = regexp.MustCompile(`^<#(\d+)>$`)
+	roleMentionRegex    = regexp.MustCompile(`^<@&(\d+)>$`)
+	snowflakeRegex      = regexp.MustCompile(`^\d+$`)
+)
+
+func (a *commandArgs) has(name string) bool {
+	_, ok := a.values[name]
+	return ok
+}
+
+func (a *commandArgs) text(name string) string {
+	v, _ := a.values[name].(string)
+	return v
+}
+
+func (a *commandArgs) user(name string) *discordgo.User {
+	v, _ := a.values[name].(*discordgo.User)
+	return v
+}
+
+func (a *commandArgs) channel(name string) *discordgo.Channel {
+	v, _ := a.values[name].(*discordgo.Channel)
+	return v
+}
+
+func (a *commandArgs) role(name string) *discordgo.Role {
+	v, _ := a.values[name].(*discordgo.Role)
+	return v
+}
+
+func (a *commandArgs) integer(name string) int {
+	v, _ := a.values[name].(int)
+	return v
+}
+
+func (a *commandArgs) duration(name string) time.Duration {
+	v, _ := a.values[name].(time.Duration)
+	return v
+}
+
+func (a *commandArgs) flag(name string) bool {
+	v, _ := a.values[name].(bool)
+	return v
+}
+
+func (a *commandArgs) attachments(name string) []*discordgo.MessageAttachment {
+	v, _ := a.values[name].([]*discordgo.MessageAttachment)
+	return v
+}
+
+type argToken struct {
+	value string
+	// start is the offset of the token in the raw input, used by argText to
+	// grab the rest of the input untouched
+	start int
+}
+
+// tokenizeArgs splits the input on whitespace, keeping "quoted strings" together.
+func tokenizeArgs(input string) ([]argToken, error) {
+	tokens := make([]argToken, 0)
+	runes := []rune(input)
+
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i++
+			continue
+		}
+
+		start := len(string(runes[:i]))
+		if close, ok := closingQuote(runes[i]); ok {
+			end := i + 1
+			for end < len(runes) && runes[end] != close {
+				end++
+			}
+			if end >= len(runes) {
+				return nil, errors.New("missing closing quote")
+			}
+			tokens = append(tokens, argToken{string(runes[i+1 : end]), start})
+			i = end + 1
+			continue
+		}
+
+		end := i
+		for end < len(runes) && unicode.IsSpace(runes[end]) == false {
+			end++
+		}
+		tokens = append(tokens, argToken{string(runes[i:end]), start})
+		i = end
+	}
+
+	return tokens, nil
+}
+
+func closingQuote(r rune) (rune, bool) {
+	switch r {
+	case '"':
+		return '"', true
+	case '“':
+		return '”', true
+	}
+	return 0, false
+}
+
+// parseMessageArgs parses the text following the command name in a message.
+func parseMessageArgs(s discordSession, m *discordgo.MessageCreate, defs []commandArg, input string) (*commandArgs, error) {
+	args := &commandArgs{values: make(map[string]interface{})}
+
+	tokens, err := tokenizeArgs(input)
+	if err != nil {
+		return nil, err
+	}
+
+	pos := 0
+	// skipFlags sets the flags in front of the next positional argument
+	skipFlags := func() {
+		for pos < len(tokens) && parseFlagToken(defs, args, tokens[pos].value) {
+			pos++
+		}
+	}
+
+	for n, def := range defs {
+		if def.kind == argAttachment && len(m.Attachments) > 0 {
+			args.values[def.name] = m.Attachments
+		}
+		if def.kind == argFlag || def.kind == argAttachment {
+			continue
+		}
+
+		skipFlags()
+		if pos >= len(tokens) {
+			break
+		}
+
+		// Once we reach an argText everything after belongs to it, flags included
+		if def.kind == argText {
+			args.values[def.name] = strings.TrimSpace(input[tokens[pos].start:])
+			pos = len(tokens)
+			break
+		}
+
+		value, err := resolveArg(s, m.GuildID, m.Mentions, def, tokens[pos].value)
+		if err != nil {
+			// An optional argument that doesn't fit is left out so the value
+			// can go to the next one, eg. !help math
+			if !def.required && hasPositionalAfter(defs, n) {
+				continue
+			}
+			return nil, err
+		}
+		args.values[def.name] = value
+		pos++
+	}
+
+	skipFlags()
+	if pos < len(tokens) {
+		return nil, fmt.Errorf("too many arguments, didn't expect `%s`", tokens[pos].value)
+	}
+
+	return args, checkRequiredArgs(defs, args)
+}
+
+// parseFlagToken sets the flag if the token is one of the defined --flags.
+func parseFlagToken(defs []commandArg, args *commandArgs, token string) bool {
+	if !strings.HasPrefix(token, "--") {
+		return false
+	}
+	def, ok := findArg(defs, strings.TrimPrefix(token, "--"))
+	if !ok || def.kind != argFlag {
+		return false
+	}
+	args.values[def.name] = true
+	return true
+}
+
+func hasPositionalAfter(defs []commandArg, n int) bool {
+	for _, def := range defs[n+1:] {
+		if def.kind != argFlag && def.kind != argAttachment {
+			return true
+		}
+	}
+	return false
+}
+
+// parseInteractionArgs turns the options of a slash command into commandArgs.
+func parseInteractionArgs(s discordSession, i *discordgo.InteractionCreate, defs []commandArg, options []*discordgo.ApplicationCommandInteractionDataOption) (*commandArgs, error) {
+	args := &commandArgs{values: make(map[string]interface{})}
+	data := i.ApplicationCommandData()
+	resolved := data.Resolved
+	if resolved == nil {
+		resolved = &discordgo.ApplicationCommandInteractionDataResolved{}
+	}
+
+	for _, opt := range options {
+		def, ok := findArg(defs, opt.Name)
+		if !ok {
+			continue
+		}
+
+		switch def.kind {
+		case argUser:
+			if u, ok := resolved.Users[opt.StringValue()]; ok {
+				args.values[def.name] = u
+			}
+		case argChannel:
+			if c, ok := resolved.Channels[opt.StringValue()]; ok {
+				args.values[def.name] = c
+			}
+		case argRole:
+			if r, ok := resolved.Roles[opt.StringValue()]; ok {
+				args.values[def.name] = r
+			}
+		case argInt:
+			args.values[def.name] = int(opt.IntValue())
+		case argFlag:
+			args.values[def.name] = opt.BoolValue()
+		case argAttachment:
+			if a, ok := resolved.Attachments[opt.StringValue()]; ok {
+				args.values[def.name] = []*discordgo.MessageAttachment{a}
+			}
+		default:
+			value, err := resolveArg(s, i.GuildID, nil, def, opt.StringValue())
+			if err != nil {
+				return nil, err
+			}
+			args.values[def.name] = value
+		}
+	}
+
+	return args, checkRequiredArgs(defs, args)
+}
+
+func resolveArg(s discordSession, guildID string, mentions []*discordgo.User, def commandArg, value string) (interface{}, error) {
+	switch def.kind {
+	case argUser:
+		id := mentionID(userMentionRegex, value)
+		if id == "" {
+			return nil, fmt.Errorf("`%s` has to be a user mention", def.name)
+		}
+		for _, u := range mentions {
+			if u.ID == id {
+				return u, nil
+			}
+		}
+		u, err := s.User(id)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't find the user given for `%s`", def.name)
+		}
+		return u, nil
+
+	case argChannel:
+		id := mentionID(channelMentionRegex, value)
+		if id == "" {
+			return nil, fmt.Errorf("`%s` has to be a channel mention", def.name)
+		}
+		c, err := s.state().Channel(id)
+		if err != nil {
+			c, err = s.Channel(id)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("couldn't find the channel given for `%s`", def.name)
+		}
+		return c, nil
+
+	case argRole:
+		id := mentionID(roleMentionRegex, value)
+		if id == "" {
+			return nil, fmt.Errorf("`%s` has to be a role mention", def.name)
+		}
+		r, err := s.state().Role(guildID, id)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't find the role given for `%s`", def.name)
+		}
+		return r, nil
+
+	case argInt:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("`%s` has to be a whole number", def.name)
+		}
+		return n, nil
+
+	case argDuration:
+		d, err := parseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("`%s` has to be a duration like `30s`, `10m` or `2d`", def.name)
+		}
+		return d, nil
+	}
+
+	return value, nil
+}
+
+// mentionID accepts both a mention and a raw snowflake ID.
+func mentionID(re *regexp.Regexp, value string) string {
+	if match := re.FindStringSubmatch(value); match != nil {
+		return match[1]
+	}
+	if snowflakeRegex.MatchString(value) {
+		return value
+	}
+	return ""
+}
+
+// parseDuration is time.ParseDuration with support for days (d) and weeks (w).
+func parseDuration(value string) (time.Duration, error) {
+	multiplier := time.Duration(0)
+	switch {
+	case strings.HasSuffix(value, "d"):
+		multiplier = 24 * time.Hour
+	case strings.HasSuffix(value, "w"):
+		multiplier = 7 * 24 * time.Hour
+	default:
+		return time.ParseDuration(value)
+	}
+
+	n, err := strconv.Atoi(value[:len(value)-1])
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(n) * multiplier, nil
+}
+
+func findArg(defs []commandArg, name string) (commandArg, bool) {
+	for _, def := range defs {
+		if def.name == name {
+			return def, true
+		}
+	}
+	return commandArg{}, false
+}
+
+func checkRequiredArgs(defs []commandArg, args *commandArgs) error {
+	for _, def := range defs {
+		if def.required && args.has(def.name) == false {
+			return fmt.Errorf("missing `%s`", def.name)
+		}
+		if def.required && def.kind == argText && len(args.text(def.name)) <= 0 {
+			return fmt.Errorf("missing `%s`", def.name)
+		}
+	}
+	return nil
+}
+
+// commandUsage renders the arguments of a command, eg. `!help [user] [command]`
+func commandUsage(prefix string, cmd *commandHandler) string {
+	var sb strings.Builder
+	sb.WriteString(prefix)
+	sb.WriteString(cmd.fullName())
+
+	if len(cmd.subcommands) > 0 {
+		names := make([]string, 0, len(cmd.subcommands))
+		for _, sub := range sortedCommands(cmd.subcommands) {
+			if len(sub.description) > 0 {
+				names = append(names, sub.commandString)
+			}
+		}
+		sb.WriteString(" <" + strings.Join(names, "|") + ">")
+	}
+
+	for _, def := range cmd.args {
+		sb.WriteString(" ")
+		name := def.name
+		if def.kind == argFlag {
+			name = "--" + name
+		}
+		if def.kind == argText {
+			name += "..."
+		}
+
+		if def.required {
+			sb.WriteString("<" + name + ">")
+		} else {
+			sb.WriteString("[" + name + "]")
+		}
+	}
+
+	return sb.String()
+}
+
+func argKindName(kind argKind) string {
+	switch kind {
+	case argText:
+		return "text"
+	case argUser:
+		return "user"
+	case argChannel:
+		return "channel"
+	case argRole:
+		return "role"
+	case argInt:
+		return "number"
+	case argDuration:
+		return "duration"
+	case argFlag:
+		return "flag"
+	case argAttachment:
+		return "attachment"
+	}
+	return "word"
+}
+
+func slashOptions(defs []commandArg) []*discordgo.ApplicationCommandOption {
+	required := make([]*discordgo.ApplicationCommandOption, 0, len(defs))
+	optional := make([]*discordgo.ApplicationCommandOption, 0, len(defs))
+
+	for _, def := range defs {
+		opt := &discordgo.ApplicationCommandOption{
+			Name:         def.name,
+			Description:  truncate(def.description, slashDescriptionLimit),
+			Required:     def.required,
+			Autocomplete: def.autocomplete,
+		}
+
+		switch def.kind {
+		case argUser:
+			opt.Type = discordgo.ApplicationCommandOptionUser
+		case argChannel:
+			opt.Type = discordgo.ApplicationCommandOptionChannel
+		case argRole:
+			opt.Type = discordgo.ApplicationCommandOptionRole
+		case argInt:
+			opt.Type = discordgo.ApplicationCommandOptionInteger
+		case argFlag:
+			opt.Type = discordgo.ApplicationCommandOptionBoolean
+		case argAttachment:
+			opt.Type = discordgo.ApplicationCommandOptionAttachment
+		default:
+			opt.Type = discordgo.ApplicationCommandOptionString
+		}
+
+		// Discord requires required options to come before optional ones
+		if def.required {
+			required = append(required, opt)
+		} else {
+			optional = append(optional, opt)
+		}
+	}
+
+	return append(required, optional...)
+}
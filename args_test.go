@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestParseMessageArgs(t *testing.T) {
+	user := &discordgo.User{ID: "42", Username: "someone"}
+	prefixArgs := []commandArg{
+		{name: "prefix", kind: argString},
+		{name: "reset", kind: argFlag},
+	}
+	countArgs := []commandArg{
+		{name: "count", kind: argInt, required: true},
+	}
+
+	tests := []struct {
+		name  string
+		defs  []commandArg
+		input string
+		want  map[string]interface{}
+		err   bool
+	}{
+		{name: "help for a command", defs: helpArgs, input: "math add", want: map[string]interface{}{"command": "math add"}},
+		{name: "help for a user", defs: helpArgs, input: "<@42>", want: map[string]interface{}{"user": user}},
+		{name: "help for a user and command", defs: helpArgs, input: "<@!42> math", want: map[string]interface{}{"user": user, "command": "math"}},
+		{name: "help", defs: helpArgs, input: "", want: map[string]interface{}{}},
+		{name: "flag", defs: prefixArgs, input: "--reset", want: map[string]interface{}{"reset": true}},
+		{name: "flag after value", defs: prefixArgs, input: "? --reset", want: map[string]interface{}{"prefix": "?", "reset": true}},
+		{name: "text keeps flags", defs: []commandArg{{name: "text", kind: argText}, {name: "reset", kind: argFlag}}, input: "a --reset b", want: map[string]interface{}{"text": "a --reset b"}},
+		{name: "quoted", defs: prefixArgs, input: `"a b"`, want: map[string]interface{}{"prefix": "a b"}},
+		{name: "too many", defs: prefixArgs, input: "a b", err: true},
+		{name: "required bad value", defs: countArgs, input: "many", err: true},
+		{name: "required missing", defs: countArgs, input: "", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &discordgo.MessageCreate{Message: &discordgo.Message{GuildID: "10", Mentions: []*discordgo.User{user}}}
+
+			// The session is only needed to look up users that weren't mentioned
+			args, err := parseMessageArgs(nil, m, tt.defs, tt.input)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", args.values)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if len(args.values) != len(tt.want) {
+				t.Fatalf("got %v, want %v", args.values, tt.want)
+			}
+			for name, want := range tt.want {
+				if got := args.values[name]; got != want {
+					t.Errorf("%s is %v, want %v", name, got, want)
+				}
+			}
+		})
+	}
+}
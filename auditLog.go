@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// auditAction is the kind of moderation action an audit entry is for.
+type auditAction string
+
+const (
+	auditMessageDeleted  auditAction = "message_deleted"
+	auditMessageWarned   auditAction = "message_warned"
+	auditMessageFlagged  auditAction = "message_flagged"
+	auditMemberBanned    auditAction = "member_banned"
+	auditBanFailed       auditAction = "ban_failed"
+	auditIdeaApproved    auditAction = "idea_approved"
+	auditIdeaRejected    auditAction = "idea_rejected"
+	auditIdeaImplemented auditAction = "idea_implemented"
+	auditIdeaEdited      auditAction = "idea_edited"
+	// auditConfigChanged covers every change to VPBot's settings, like
+	// !config, !prefix, !perm, !module and !police rules
+	auditConfigChanged auditAction = "config_changed"
+)
+
+var auditActionTitles = map[auditAction]string{
+	auditMessageDeleted:  "Message deleted",
+	auditMessageWarned:   "Author warned about message",
+	auditMessageFlagged:  "Message flagged",
+	auditMemberBanned:    "Member banned",
+	auditBanFailed:       "Ban failed",
+	auditIdeaApproved:    "Idea approved",
+	auditIdeaRejected:    "Idea rejected",
+	auditIdeaImplemented: "Idea implemented",
+	auditIdeaEdited:      "Idea edited",
+	auditConfigChanged:   "Settings changed",
+}
+
+const (
+	auditUserDefault = 10
+	auditUserLimit   = 25
+)
+
+func initAuditLog(db *storage) {
+	auditLog = newSQLAuditLogStore(db)
+}
+
+// recordAudit stores the action and posts it in the guild's audit channel,
+// if it has one.
+func recordAudit(s discordSession, e auditEntry) {
+	if err := auditLog.add(&e); err != nil {
+		log.Printf("Error trying to save %s by %s to the audit log: %s", e.action, e.actorID, err)
+		e.createdAt = time.Now().UTC()
+	}
+
+	channelID := guildConfigGet(e.guildID, configAuditChannel)
+	if len(channelID) <= 0 {
+		return
+	}
+
+	_, err := s.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+		Embeds:          []*discordgo.MessageEmbed{auditEmbed(s, e)},
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if err != nil {
+		log.Printf("Couldn't post %s by %s in the audit channel of %s: %s", e.action, e.actorID, e.guildID, err)
+	}
+}
+
+// auditAutomatic records an action VPBot took by itself.
+func auditAutomatic(s discordSession, e auditEntry) {
+	e.actorID = s.state().User.ID
+	recordAudit(s, e)
+}
+
+// auditCommand records an action the author of a command took with it.
+func auditCommand(ctx *commandContext, action auditAction, targetID string, details string) {
+	recordAudit(ctx.session, auditEntry{
+		guildID:   ctx.guildID,
+		action:    action,
+		actorID:   ctx.author.ID,
+		targetID:  targetID,
+		channelID: ctx.channelID,
+		details:   details,
+	})
+}
+
+func auditEmbed(s discordSession, e auditEntry) *discordgo.MessageEmbed {
+	fields := []*discordgo.MessageEmbedField{
+		{Name: "By", Value: describeAuditActor(s, e), Inline: true},
+	}
+	if len(e.targetID) > 0 {
+		fields = append(fields, &discordgo.MessageEmbedField{Name: "User", Value: fmt.Sprintf("<@%s>", e.targetID), Inline: true})
+	}
+	if len(e.channelID) > 0 {
+		fields = append(fields, &discordgo.MessageEmbedField{Name: "Channel", Value: fmt.Sprintf("<#%s>", e.channelID), Inline: true})
+	}
+
+	color := helpEmbedColor
+	switch e.action {
+	case auditMessageDeleted, auditMemberBanned, auditIdeaRejected:
+		color = ideaRejectedColor
+	case auditIdeaApproved, auditIdeaImplemented:
+		color = ideaApprovedColor
+	}
+
+	return &discordgo.MessageEmbed{
+		Title:       auditActionTitle(e.action),
+		Description: truncate(e.details, 4096),
+		Fields:      fields,
+		Color:       color,
+		Footer:      &discordgo.MessageEmbedFooter{Text: fmt.Sprintf("Audit entry %d", e.id)},
+		Timestamp:   e.createdAt.Format(time.RFC3339),
+	}
+}
+
+func auditActionTitle(action auditAction) string {
+	if title, ok := auditActionTitles[action]; ok {
+		return title
+	}
+	return string(action)
+}
+
+func describeAuditActor(s discordSession, e auditEntry) string {
+	if e.actorID == s.state().User.ID {
+		return "VPBot, automatically"
+	}
+	return fmt.Sprintf("<@%s>", e.actorID)
+}
+
+func auditUserHandler(ctx *commandContext) {
+	user := ctx.args.user("user")
+	count := auditUserDefault
+	if ctx.args.has("count") {
+		count = ctx.args.integer("count")
+	}
+	if count <= 0 || count > auditUserLimit {
+		ctx.reply(fmt.Sprintf("`count` has to be between 1 and %d", auditUserLimit))
+		return
+	}
+
+	entries, err := auditLog.listByUser(ctx.guildID, user.ID, count)
+	if err != nil {
+		log.Printf("Error trying to load the audit log of %s: %s", user.ID, err)
+		ctx.reply("Couldn't load the audit log, try again later")
+		return
+	}
+	if len(entries) <= 0 {
+		ctx.reply(fmt.Sprintf("No moderation actions have been taken against %s", user.String()))
+		return
+	}
+
+	var sb strings.Builder
+	for _, e := range entries {
+		sb.WriteString(fmt.Sprintf("`%d` %s **%s** by %s", e.id, discordTimestamp(e.createdAt), auditActionTitle(e.action), describeAuditActor(ctx.session, e)))
+		if len(e.channelID) > 0 {
+			sb.WriteString(fmt.Sprintf(" in <#%s>", e.channelID))
+		}
+		sb.WriteString("\n")
+		if len(e.details) > 0 {
+			sb.WriteString(fmt.Sprintf("> %s\n", strings.ReplaceAll(truncate(e.details, 150), "\n", " ")))
+		}
+	}
+
+	ctx.replyMessage(&discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{{
+		Title:       fmt.Sprintf("Moderation history of %s", user.String()),
+		Description: truncate(sb.String(), 4096),
+		Color:       helpEmbedColor,
+	}}})
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+)
+
+// auditEntry is one moderation action, taken by a mod or by VPBot itself.
+type auditEntry struct {
+	id      int
+	guildID string
+	action  auditAction
+	// actorID is who took the action, VPBot's own ID for automatic ones
+	actorID string
+	// targetID is the user the action was taken against, empty for actions
+	// like config changes
+	targetID  string
+	channelID string
+	details   string
+	createdAt time.Time
+}
+
+type auditLogStore interface {
+	// add stores the entry and sets its ID and creation time
+	add(e *auditEntry) error
+	// listByUser returns the latest actions taken against the user, newest first
+	listByUser(guildID string, userID string, limit int) ([]auditEntry, error)
+}
+
+type sqlAuditLogStore struct {
+	insert      *sql.Stmt
+	queryByUser *sql.Stmt
+}
+
+func newSQLAuditLogStore(db *storage) *sqlAuditLogStore {
+	return &sqlAuditLogStore{
+		insert: dbPrepare(db, `INSERT INTO audit_log (guild_id, action, actor_id, target_id, channel_id, details, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`),
+		queryByUser: dbPrepare(db, `SELECT id, action, actor_id, target_id, channel_id, details, created_at FROM audit_log
+			WHERE guild_id = $1 AND target_id = $2 ORDER BY created_at DESC, id DESC LIMIT $3`),
+	}
+}
+
+func (s *sqlAuditLogStore) add(e *auditEntry) error {
+	e.createdAt = time.Now().UTC()
+	return s.insert.QueryRow(e.guildID, e.action, e.actorID, e.targetID, e.channelID, e.details, e.createdAt).Scan(&e.id)
+}
+
+func (s *sqlAuditLogStore) listByUser(guildID string, userID string, limit int) ([]auditEntry, error) {
+	rows, err := s.queryByUser.Query(guildID, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]auditEntry, 0)
+	for rows.Next() {
+		e := auditEntry{guildID: guildID}
+		if err := rows.Scan(&e.id, &e.action, &e.actorID, &e.targetID, &e.channelID, &e.details, &e.createdAt); err != nil {
+			return nil, err
+		}
+		result = append(result, e)
+	}
+	return result, rows.Err()
+}
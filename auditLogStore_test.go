@@ -0,0 +1,120 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAuditLogStore(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []auditEntry
+		guildID string
+		userID  string
+		limit   int
+		want    []string
+	}{
+		{
+			name: "newest first",
+			entries: []auditEntry{
+				{guildID: "1", targetID: "a", details: "first"},
+				{guildID: "1", targetID: "a", details: "second"},
+			},
+			guildID: "1", userID: "a", limit: 10,
+			want: []string{"second", "first"},
+		},
+		{
+			name: "only the user in the guild",
+			entries: []auditEntry{
+				{guildID: "1", targetID: "a", details: "mine"},
+				{guildID: "1", targetID: "b", details: "other user"},
+				{guildID: "2", targetID: "a", details: "other guild"},
+				{guildID: "1", details: "config"},
+			},
+			guildID: "1", userID: "a", limit: 10,
+			want: []string{"mine"},
+		},
+		{
+			name: "limit",
+			entries: []auditEntry{
+				{guildID: "1", targetID: "a", details: "first"},
+				{guildID: "1", targetID: "a", details: "second"},
+				{guildID: "1", targetID: "a", details: "third"},
+			},
+			guildID: "1", userID: "a", limit: 2,
+			want: []string{"third", "second"},
+		},
+		{name: "nothing", guildID: "1", userID: "a", limit: 10, want: []string{}},
+	}
+
+	for _, tt := range tests {
+		stores := map[string]auditLogStore{
+			"sql":    newSQLAuditLogStore(newTestStorage(t)),
+			"memory": newMemoryAuditLogStore(),
+		}
+		for name, s := range stores {
+			t.Run(tt.name+"/"+name, func(t *testing.T) {
+				for _, e := range tt.entries {
+					e.action = auditMessageDeleted
+					if err := s.add(&e); err != nil {
+						t.Fatal(err)
+					}
+					if e.id <= 0 || e.createdAt.IsZero() {
+						t.Fatalf("added entry has ID %d, created at %s", e.id, e.createdAt)
+					}
+				}
+
+				entries, err := s.listByUser(tt.guildID, tt.userID, tt.limit)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := make([]string, 0, len(entries))
+				for _, e := range entries {
+					got = append(got, e.details)
+				}
+				if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+					t.Errorf("got %v, want %v", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+type memoryAuditLogStore struct {
+	mutex   sync.Mutex
+	entries []auditEntry
+}
+
+func newMemoryAuditLogStore() *memoryAuditLogStore {
+	return &memoryAuditLogStore{}
+}
+
+func (s *memoryAuditLogStore) add(e *auditEntry) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	e.id = len(s.entries) + 1
+	e.createdAt = time.Now().UTC()
+	s.entries = append(s.entries, *e)
+	return nil
+}
+
+func (s *memoryAuditLogStore) listByUser(guildID string, userID string, limit int) ([]auditEntry, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	result := make([]auditEntry, 0)
+	for _, e := range s.entries {
+		if e.guildID == guildID && e.targetID == userID {
+			result = append(result, e)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].id > result[j].id })
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/go-co-op/gocron"
+)
+
+const clonexModuleName = "clonex"
+
+var clonexModule = &module{
+	name:           clonexModuleName,
+	description:    "Automatically ban the clonex scam bots when they join",
+	defaultEnabled: true,
+	setup: func(m *module, _ *storage, _ *gocron.Scheduler) {
+		m.addEventHandler(clonexBanProcedure)
+	},
+}
+
+func clonexBanProcedure(s discordSession, e *discordgo.GuildMemberAdd) {
+	if moduleEnabledByName(e.GuildID, clonexModuleName) == false {
+		return
+	}
+
+	if strings.Contains(strings.ToLower(e.User.Username), "clonex") {
+		modChannelID := guildConfigGet(e.GuildID, configModChannel)
+		reason := "auto ban cause scam bots for clonex"
+		err := s.GuildBanCreateWithReason(e.GuildID, e.User.ID, reason, 7)
+		if err != nil {
+			s.ChannelMessageSend(modChannelID, fmt.Sprintf("Unable to ban %v, %v", e.User.Username, err))
+			auditAutomatic(s, auditEntry{
+				guildID:  e.GuildID,
+				action:   auditBanFailed,
+				targetID: e.User.ID,
+				details:  fmt.Sprintf("%s joined, couldn't ban them: %s", e.User.Username, err),
+			})
+		} else {
+			s.ChannelMessageSend(modChannelID, fmt.Sprintf("Auto banned %v", e.User.Username))
+			auditAutomatic(s, auditEntry{
+				guildID:  e.GuildID,
+				action:   auditMemberBanned,
+				targetID: e.User.ID,
+				details:  fmt.Sprintf("%s joined, %s", e.User.Username, reason),
+			})
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestClonexBanProcedure(t *testing.T) {
+	useTestStorage(t)
+	if _, ok := moduleMap[clonexModuleName]; !ok {
+		moduleMap[clonexModuleName] = clonexModule
+		t.Cleanup(func() { delete(moduleMap, clonexModuleName) })
+	}
+	if err := guildConfigSet("80", configModChannel, "81"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		banErr   error
+		// told is what the mods are told, empty if VPBot shouldn't ban
+		told  string
+		audit auditAction
+	}{
+		{name: "clonex", username: "CloneX Giveaway", told: "Auto banned CloneX Giveaway", audit: auditMemberBanned},
+		{name: "ban failing", username: "clonexmint", banErr: &discordgo.RESTError{Message: &discordgo.APIErrorMessage{Message: "Missing Permissions"}},
+			told: "Unable to ban clonexmint", audit: auditBanFailed},
+		{name: "someone else", username: "clone"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeSession(&discordgo.User{ID: "100"})
+			if tt.banErr != nil {
+				f.failWith("GuildBanCreateWithReason", tt.banErr)
+			}
+
+			clonexBanProcedure(f, &discordgo.GuildMemberAdd{Member: &discordgo.Member{
+				GuildID: "80",
+				User:    &discordgo.User{ID: "82", Username: tt.username},
+			}})
+
+			bans := f.callsTo("GuildBanCreateWithReason")
+			if tried := len(tt.told) > 0; (len(bans) > 0) != tried {
+				t.Errorf("tried to ban %d times", len(bans))
+			}
+			sent := f.sentTo("81")
+			if len(tt.told) <= 0 {
+				if len(sent) > 0 {
+					t.Errorf("told the mods %+v", sent)
+				}
+				return
+			}
+			if len(sent) != 1 || !strings.HasPrefix(sent[0].Content, tt.told) {
+				t.Errorf("told the mods %+v, want %q", sent, tt.told)
+			}
+
+			entries, err := auditLog.listByUser("80", "82", 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 || entries[0].action != tt.audit {
+				t.Errorf("got audit entries %+v, want %s", entries, tt.audit)
+			}
+		})
+	}
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+type commandHandler struct {
+	commandString string
+	description   string
+	// category groups commands in help, subcommands default to their group's
+	category string
+	modOnly  bool
+	// guildOnly commands can't be used in DMs
+	guildOnly bool
+	// ephemeral makes slash command replies only visible to the invoking user
+	ephemeral bool
+	args      []commandArg
+	// checkArgs validates the parsed arguments beyond their kinds, eg. that
+	// a name refers to something that exists
+	checkArgs    func(*commandContext) error
+	autocomplete func(*commandContext, *discordgo.ApplicationCommandInteractionDataOption) []*discordgo.ApplicationCommandOptionChoice
+	// handleFunc is nil for groups, running a group shows its help instead
+	handleFunc func(*commandContext)
+	aliases    []string
+	cooldown   commandCooldown
+	// module is set for top level commands registered by a module
+	module *module
+
+	parent            *commandHandler
+	subcommands       map[string]*commandHandler
+	subcommandAliases map[string]*commandHandler
+}
+
+// commandContext is what a command handler gets to work with, regardless of
+// whether it was invoked through a `!` message or a slash command.
+type commandContext struct {
+	session   discordSession
+	command   *commandHandler
+	guildID   string
+	channelID string
+	author    *discordgo.User
+	args      *commandArgs
+
+	message     *discordgo.MessageCreate
+	interaction *discordgo.InteractionCreate
+	responded   bool
+}
+
+func handleCommand(cmdString string,
+	desc string,
+	modOnly bool,
+	handler func(*commandContext)) *commandHandler {
+	return addCommand(&commandHandler{
+		commandString: cmdString,
+		description:   desc,
+		modOnly:       modOnly,
+		handleFunc:    handler,
+	})
+}
+
+func addCommand(cmd *commandHandler) *commandHandler {
+	if _, ok := lookupCommand(commandMap, commandAliasMap, cmd.commandString); ok {
+		log.Fatalf("Tried adding handler for '%s' when it already has one!", cmd.commandString)
+	}
+
+	commandMap[cmd.commandString] = cmd
+	for _, alias := range cmd.aliases {
+		addCommandAlias(alias, cmd)
+	}
+	return cmd
+}
+
+// addCommandAlias makes the top level name alias run target, which can also
+// be a subcommand, eg. `!addidea` for `!idea add`.
+func addCommandAlias(alias string, target *commandHandler) {
+	if _, ok := lookupCommand(commandMap, commandAliasMap, alias); ok {
+		log.Fatalf("Tried adding alias '%s' for '%s' when it's already in use!", alias, target.fullName())
+	}
+
+	commandAliasMap[alias] = target
+}
+
+// lookupCommand finds a command by its name or one of its aliases.
+func lookupCommand(cmds map[string]*commandHandler, aliases map[string]*commandHandler, name string) (*commandHandler, bool) {
+	name = strings.ToLower(name)
+	if cmd, ok := cmds[name]; ok {
+		return cmd, true
+	}
+	cmd, ok := aliases[name]
+	return cmd, ok
+}
+
+// commandAliasesOf returns every way of invoking cmd other than its full name.
+func commandAliasesOf(cmd *commandHandler) []string {
+	result := make([]string, 0)
+	for alias, target := range commandAliasMap {
+		if target == cmd {
+			result = append(result, alias)
+		}
+	}
+	if cmd.parent != nil {
+		for alias, target := range cmd.parent.subcommandAliases {
+			if target == cmd {
+				result = append(result, cmd.parent.fullName()+" "+alias)
+			}
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// addSubcommand adds cmd to group, the group's modOnly and ephemeral act as
+// defaults for all of its subcommands.
+func addSubcommand(group *commandHandler, cmd *commandHandler) *commandHandler {
+	if group.subcommands == nil {
+		group.subcommands = make(map[string]*commandHandler)
+	}
+
+	if group.subcommandAliases == nil {
+		group.subcommandAliases = make(map[string]*commandHandler)
+	}
+
+	names := append([]string{cmd.commandString}, cmd.aliases...)
+	for _, name := range names {
+		if _, ok := lookupCommand(group.subcommands, group.subcommandAliases, name); ok {
+			log.Fatalf("Tried adding handler for '%s %s' when it already has one!", group.fullName(), name)
+		}
+	}
+
+	if group.modOnly {
+		cmd.modOnly = true
+	}
+	if group.ephemeral {
+		cmd.ephemeral = true
+	}
+	if group.guildOnly {
+		cmd.guildOnly = true
+	}
+	if len(cmd.category) <= 0 {
+		cmd.category = group.category
+	}
+
+	cmd.parent = group
+	group.subcommands[cmd.commandString] = cmd
+	for _, alias := range cmd.aliases {
+		group.subcommandAliases[alias] = cmd
+	}
+	return cmd
+}
+
+// fullName is the name of the command including its groups, eg. "math add"
+func (cmd *commandHandler) fullName() string {
+	if cmd.parent == nil {
+		return cmd.commandString
+	}
+	return cmd.parent.fullName() + " " + cmd.commandString
+}
+
+// resolveSubcommand walks down the subcommands of cmd as far as the
+// words in rest allow, returning the command found and what's left of rest.
+func resolveSubcommand(cmd *commandHandler, rest string) (*commandHandler, string) {
+	for len(cmd.subcommands) > 0 {
+		name, remaining := splitCommand(rest)
+		sub, ok := lookupCommand(cmd.subcommands, cmd.subcommandAliases, name)
+		if !ok {
+			break
+		}
+		cmd, rest = sub, remaining
+	}
+	return cmd, rest
+}
+
+// findCommand looks up a command by its full name, eg. "math add"
+func findCommand(name string) (*commandHandler, bool) {
+	first, rest := splitCommand(strings.TrimSpace(name))
+	cmd, ok := lookupCommand(commandMap, commandAliasMap, first)
+	if !ok {
+		return nil, false
+	}
+
+	cmd, rest = resolveSubcommand(cmd, rest)
+	if len(rest) > 0 {
+		return nil, false
+	}
+	return cmd, true
+}
+
+// sortedCommands returns the commands sorted by name, so output built from
+// them doesn't change order between runs.
+func sortedCommands(cmds map[string]*commandHandler) []*commandHandler {
+	result := make([]*commandHandler, 0, len(cmds))
+	for _, cmd := range cmds {
+		result = append(result, cmd)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].commandString < result[j].commandString })
+	return result
+}
+
+func newMessageCommandContext(s discordSession, m *discordgo.MessageCreate, cmd *commandHandler, rest string) (*commandContext, error) {
+	ctx := &commandContext{
+		session:   s,
+		command:   cmd,
+		guildID:   m.GuildID,
+		channelID: m.ChannelID,
+		author:    m.Author,
+		args:      &commandArgs{values: make(map[string]interface{})},
+		message:   m,
+	}
+
+	args, err := parseMessageArgs(s, m, cmd.args, rest)
+	if err != nil {
+		return ctx, err
+	}
+	ctx.args = args
+
+	if cmd.checkArgs != nil {
+		return ctx, cmd.checkArgs(ctx)
+	}
+	return ctx, nil
+}
+
+func newInteractionCommandContext(s discordSession, i *discordgo.InteractionCreate, cmd *commandHandler, options []*discordgo.ApplicationCommandInteractionDataOption) (*commandContext, error) {
+	ctx := &commandContext{
+		session:     s,
+		command:     cmd,
+		guildID:     i.GuildID,
+		channelID:   i.ChannelID,
+		author:      interactionUser(i),
+		args:        &commandArgs{values: make(map[string]interface{})},
+		interaction: i,
+	}
+
+	args, err := parseInteractionArgs(s, i, cmd.args, options)
+	if err != nil {
+		return ctx, err
+	}
+	ctx.args = args
+
+	if cmd.checkArgs != nil {
+		return ctx, cmd.checkArgs(ctx)
+	}
+	return ctx, nil
+}
+
+func interactionUser(i *discordgo.InteractionCreate) *discordgo.User {
+	if i.Member != nil {
+		return i.Member.User
+	}
+	return i.User
+}
+
+// reply answers the command in the channel it was invoked from, for slash
+// commands the first reply is the interaction response and the rest are
+// followups.
+func (ctx *commandContext) reply(content string) {
+	ctx.replyMessage(&discordgo.MessageSend{Content: content})
+}
+
+// replyMessage is reply for messages with embeds or components.
+func (ctx *commandContext) replyMessage(msg *discordgo.MessageSend) {
+	if ctx.interaction == nil {
+		_, err := ctx.session.ChannelMessageSendComplex(ctx.channelID, msg)
+		if err != nil {
+			log.Printf("Couldn't reply to %s: %s", ctx.command.fullName(), err)
+		}
+		return
+	}
+
+	var flags discordgo.MessageFlags
+	if ctx.command != nil && ctx.command.ephemeral {
+		flags = discordgo.MessageFlagsEphemeral
+	}
+
+	if ctx.responded {
+		_, err := ctx.session.FollowupMessageCreate(ctx.interaction.Interaction, false, &discordgo.WebhookParams{
+			Content:    msg.Content,
+			Embeds:     msg.Embeds,
+			Components: msg.Components,
+			Flags:      flags,
+		})
+		if err != nil {
+			log.Printf("Couldn't send followup for /%s: %s", ctx.command.fullName(), err)
+		}
+		return
+	}
+
+	err := ctx.session.InteractionRespond(ctx.interaction.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content:    msg.Content,
+			Embeds:     msg.Embeds,
+			Components: msg.Components,
+			Flags:      flags,
+		},
+	})
+	if err != nil {
+		log.Printf("Couldn't respond to /%s: %s", ctx.command.fullName(), err)
+	}
+	ctx.responded = true
+}
+
+// splitCommand splits a message into the command name and whatever follows it.
+func splitCommand(content string) (string, string) {
+	idx := strings.IndexFunc(content, unicode.IsSpace)
+	if idx < 0 {
+		return content, ""
+	}
+	return content[:idx], strings.TrimSpace(content[idx:])
+}
+
+// replyUsage tells the user what was wrong with the arguments they gave.
+func replyUsage(ctx *commandContext, err error) {
+	ctx.reply(fmt.Sprintf("Usage: `%s`\n%s", commandUsage(ctx.prefix(), ctx.command), err))
+}
+
+func runCommand(ctx *commandContext) {
+	cmd := ctx.command
+	if cmd.guildOnly && len(ctx.guildID) <= 0 {
+		ctx.reply("This command can only be used in a server")
+		return
+	}
+
+	if m := commandModule(cmd); moduleEnabled(ctx.guildID, m) == false {
+		ctx.reply(fmt.Sprintf("The %s module is disabled in this server", m.name))
+		return
+	}
+
+	if commandAllowed(ctx.session, ctx.guildID, ctx.channelID, ctx.author.ID, cmd) == false {
+		log.Printf("User %s tried to use command %s but is not allowed", ctx.author.String(), cmd.fullName())
+		ctx.reply("Sorry, but we're not that type of friends </3")
+		return
+	}
+
+	if cmd.handleFunc == nil {
+		groupHelpHandler(ctx)
+		return
+	}
+
+	if remaining := useCooldown(ctx); remaining > 0 {
+		log.Printf("User %s tried to use command %s but it's on cooldown for %s", ctx.author.String(), cmd.fullName(), remaining)
+		ctx.reply(fmt.Sprintf("Slow down! Try again in %ds", int(math.Ceil(remaining.Seconds()))))
+		return
+	}
+
+	log.Printf("Running %s command handler for %s", cmd.fullName(), ctx.author.String())
+	cmd.handleFunc(ctx)
+
+	// Discord shows the interaction as failed if it never gets a response
+	if ctx.interaction != nil && ctx.responded == false {
+		ctx.reply("Done!")
+	}
+}
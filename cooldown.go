@@ -0,0 +1,63 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// commandCooldown is how long a command has to rest after being used,
+// a zero duration means no cooldown of that kind.
+type commandCooldown struct {
+	user    time.Duration
+	channel time.Duration
+	// global is shared by everyone in the guild
+	global time.Duration
+}
+
+var (
+	cooldownMutex sync.Mutex
+	// cooldownExpiry maps a cooldown key to the time it runs out
+	cooldownExpiry = make(map[string]time.Time)
+)
+
+// useCooldown starts the cooldowns of the command in ctx, unless one of them
+// is still running in which case the time left is returned instead.
+func useCooldown(ctx *commandContext) time.Duration {
+	cmd := ctx.command
+	name := cmd.fullName()
+	cooldowns := []struct {
+		key      string
+		duration time.Duration
+	}{
+		{"user:" + name + ":" + ctx.author.ID, cmd.cooldown.user},
+		{"channel:" + name + ":" + ctx.channelID, cmd.cooldown.channel},
+		{"global:" + name + ":" + ctx.guildID, cmd.cooldown.global},
+	}
+
+	cooldownMutex.Lock()
+	defer cooldownMutex.Unlock()
+
+	now := time.Now()
+	for key, expiry := range cooldownExpiry {
+		if now.After(expiry) {
+			delete(cooldownExpiry, key)
+		}
+	}
+
+	var remaining time.Duration
+	for _, c := range cooldowns {
+		if expiry, ok := cooldownExpiry[c.key]; ok && expiry.Sub(now) > remaining {
+			remaining = expiry.Sub(now)
+		}
+	}
+	if remaining > 0 {
+		return remaining
+	}
+
+	for _, c := range cooldowns {
+		if c.duration > 0 {
+			cooldownExpiry[c.key] = now.Add(c.duration)
+		}
+	}
+	return 0
+}
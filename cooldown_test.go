@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestUseCooldown(t *testing.T) {
+	cooldownMutex.Lock()
+	cooldownExpiry = make(map[string]time.Time)
+	cooldownMutex.Unlock()
+
+	cmd := &commandHandler{commandString: "cooldowntest", cooldown: commandCooldown{global: time.Minute}}
+	use := func(guildID string, userID string) time.Duration {
+		return useCooldown(&commandContext{command: cmd, guildID: guildID, channelID: guildID + "-chan", author: &discordgo.User{ID: userID}})
+	}
+
+	if left := use("1", "a"); left != 0 {
+		t.Fatalf("first use is on cooldown for %s", left)
+	}
+	if left := use("1", "b"); left <= 0 {
+		t.Errorf("global cooldown doesn't apply to others in the guild")
+	}
+	if left := use("2", "a"); left != 0 {
+		t.Errorf("global cooldown leaks into another guild, %s left", left)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// databaseConfig is how to connect to the database, read from VPBOT_DB_*
+// and DATABASE_URL.
+type databaseConfig struct {
+	driver string
+	// url is a full connection URL, used instead of the separate settings
+	url string
+
+	host        string
+	port        int
+	user        string
+	password    string
+	name        string
+	sslMode     string
+	sslRootCert string
+	sslCert     string
+	sslKey      string
+
+	// path is the SQLite database file
+	path string
+
+	maxOpenConns    int
+	maxIdleConns    int
+	connMaxLifetime time.Duration
+	// connectAttempts is how many times to try reaching the database on startup
+	connectAttempts int
+}
+
+func loadDatabaseConfig() databaseConfig {
+	cfg := databaseConfig{
+		driver:          strings.ToLower(os.Getenv("VPBOT_DB_DRIVER")),
+		url:             os.Getenv("DATABASE_URL"),
+		host:            os.Getenv("VPBOT_DB_HOST"),
+		port:            envInt("VPBOT_DB_PORT", 5432),
+		user:            os.Getenv("VPBOT_DB_USER"),
+		password:        os.Getenv("VPBOT_DB_PASS"),
+		name:            envString("VPBOT_DB_NAME", "vpbot"),
+		sslMode:         envString("VPBOT_DB_SSLMODE", "disable"),
+		sslRootCert:     os.Getenv("VPBOT_DB_SSLROOTCERT"),
+		sslCert:         os.Getenv("VPBOT_DB_SSLCERT"),
+		sslKey:          os.Getenv("VPBOT_DB_SSLKEY"),
+		path:            envString("VPBOT_DB_PATH", "vpbot.db"),
+		maxOpenConns:    envInt("VPBOT_DB_MAX_OPEN_CONNS", 0),
+		maxIdleConns:    envInt("VPBOT_DB_MAX_IDLE_CONNS", 2),
+		connMaxLifetime: envDuration("VPBOT_DB_CONN_MAX_LIFETIME", 0),
+		connectAttempts: envInt("VPBOT_DB_CONNECT_ATTEMPTS", 10),
+	}
+
+	// The URL decides the driver, so DATABASE_URL alone is enough
+	if len(cfg.url) > 0 && len(cfg.driver) <= 0 {
+		if strings.HasPrefix(cfg.url, "sqlite:") {
+			cfg.driver = "sqlite"
+		} else {
+			cfg.driver = "postgres"
+		}
+	}
+	if len(cfg.driver) <= 0 {
+		cfg.driver = "postgres"
+	}
+
+	return cfg
+}
+
+// postgresDSN builds the lib/pq connection string, which takes URLs as is.
+func (cfg databaseConfig) postgresDSN() string {
+	if len(cfg.url) > 0 {
+		return cfg.url
+	}
+
+	settings := []struct{ key, value string }{
+		{"host", cfg.host},
+		{"port", strconv.Itoa(cfg.port)},
+		{"user", cfg.user},
+		{"password", cfg.password},
+		{"dbname", cfg.name},
+		{"sslmode", cfg.sslMode},
+		{"sslrootcert", cfg.sslRootCert},
+		{"sslcert", cfg.sslCert},
+		{"sslkey", cfg.sslKey},
+	}
+
+	parts := make([]string, 0, len(settings))
+	for _, s := range settings {
+		if len(s.value) > 0 {
+			parts = append(parts, fmt.Sprintf("%s=%s", s.key, quoteDSNValue(s.value)))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// sqlitePath is the database file, from either sqlite://<path> or VPBOT_DB_PATH.
+func (cfg databaseConfig) sqlitePath() string {
+	if strings.HasPrefix(cfg.url, "sqlite:") {
+		return strings.TrimPrefix(strings.TrimPrefix(cfg.url, "sqlite:"), "//")
+	}
+	return cfg.path
+}
+
+// quoteDSNValue quotes a value for a key=value connection string, so
+// passwords with spaces or quotes work.
+func quoteDSNValue(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `'`, `\'`)
+	return "'" + value + "'"
+}
+
+func envString(key string, def string) string {
+	if value := os.Getenv(key); len(value) > 0 {
+		return value
+	}
+	return def
+}
+
+func envInt(key string, def int) int {
+	value := os.Getenv(key)
+	if len(value) <= 0 {
+		return def
+	}
+
+	result, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Invalid %s '%s', using %d: %s", key, value, def, err)
+		return def
+	}
+	return result
+}
+
+func envDuration(key string, def time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if len(value) <= 0 {
+		return def
+	}
+
+	result, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid %s '%s', using %s: %s", key, value, def, err)
+		return def
+	}
+	return result
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/gorilla/websocket"
+)
+
+// fakeDiscordRequest is a REST request VPBot made to a fakeDiscord, path is
+// without the /api/v<version> prefix.
+type fakeDiscordRequest struct {
+	method string
+	path   string
+	body   []byte
+}
+
+// fakeDiscord is a local stand-in for the Discord REST API and gateway, tests
+// set discordURL to its url before calling run to use it. It answers REST
+// requests with just enough to keep VPBot going and records them, and events
+// can be sent to VPBot with dispatch once it has connected.
+type fakeDiscord struct {
+	server  *httptest.Server
+	botUser *discordgo.User
+	guilds  []*discordgo.Guild
+
+	mutex    sync.Mutex
+	requests []fakeDiscordRequest
+	messages map[string]*discordgo.Message
+	nextID   int
+	// requestAdded is closed and replaced whenever a request is recorded
+	requestAdded chan struct{}
+
+	wsMutex  sync.Mutex
+	ws       *websocket.Conn
+	sequence int
+	ready    chan struct{}
+}
+
+// newFakeDiscord starts a fakeDiscord logged in as botUser and in guilds,
+// which are sent to VPBot as they are once it connects.
+func newFakeDiscord(botUser *discordgo.User, guilds ...*discordgo.Guild) *fakeDiscord {
+	f := &fakeDiscord{
+		botUser:      botUser,
+		guilds:       guilds,
+		messages:     make(map[string]*discordgo.Message),
+		nextID:       1000,
+		requestAdded: make(chan struct{}),
+		ready:        make(chan struct{}),
+	}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	return f
+}
+
+func (f *fakeDiscord) url() string {
+	return f.server.URL
+}
+
+func (f *fakeDiscord) close() {
+	f.wsMutex.Lock()
+	if f.ws != nil {
+		f.ws.Close()
+	}
+	f.wsMutex.Unlock()
+	f.server.Close()
+}
+
+// waitReady waits for VPBot to connect to the gateway and get its READY.
+func (f *fakeDiscord) waitReady(timeout time.Duration) error {
+	select {
+	case <-f.ready:
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("VPBot didn't connect to the gateway within %s", timeout)
+	}
+}
+
+// dispatch sends a gateway event to VPBot, eventType is like MESSAGE_CREATE
+// and data is marshalled as its payload.
+func (f *fakeDiscord) dispatch(eventType string, data interface{}) error {
+	f.wsMutex.Lock()
+	defer f.wsMutex.Unlock()
+
+	if f.ws == nil {
+		return fmt.Errorf("VPBot isn't connected to the gateway")
+	}
+
+	f.sequence++
+	return f.ws.WriteJSON(map[string]interface{}{"op": 0, "t": eventType, "s": f.sequence, "d": data})
+}
+
+// requestsTo returns the requests made with method to paths starting with
+// pathPrefix, in order.
+func (f *fakeDiscord) requestsTo(method string, pathPrefix string) []fakeDiscordRequest {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	result := make([]fakeDiscordRequest, 0)
+	for _, r := range f.requests {
+		if r.method == method && strings.HasPrefix(r.path, pathPrefix) {
+			result = append(result, r)
+		}
+	}
+	return result
+}
+
+// waitForRequest waits until a request like requestsTo finds has been made
+// and returns the first one.
+func (f *fakeDiscord) waitForRequest(method string, pathPrefix string, timeout time.Duration) (fakeDiscordRequest, error) {
+	deadline := time.After(timeout)
+	for {
+		f.mutex.Lock()
+		added := f.requestAdded
+		f.mutex.Unlock()
+
+		if found := f.requestsTo(method, pathPrefix); len(found) > 0 {
+			return found[0], nil
+		}
+
+		select {
+		case <-added:
+		case <-deadline:
+			return fakeDiscordRequest{}, fmt.Errorf("no %s %s request within %s", method, pathPrefix, timeout)
+		}
+	}
+}
+
+// addMessage stores m as if it had been sent before VPBot connected.
+func (f *fakeDiscord) addMessage(m *discordgo.Message) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.messages[m.ID] = m
+}
+
+func (f *fakeDiscord) newID() string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.nextID++
+	return strconv.Itoa(f.nextID)
+}
+
+func (f *fakeDiscord) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	// discordgo adds a trailing slash to the gateway URL
+	if strings.TrimSuffix(req.URL.Path, "/") == "/gateway-ws" {
+		f.serveGateway(w, req)
+		return
+	}
+
+	body, _ := ioutil.ReadAll(req.Body)
+	path := "/" + strings.TrimPrefix(strings.TrimPrefix(req.URL.Path, "/api/v"+discordgo.APIVersion), "/")
+
+	f.mutex.Lock()
+	f.requests = append(f.requests, fakeDiscordRequest{req.Method, path, body})
+	close(f.requestAdded)
+	f.requestAdded = make(chan struct{})
+	f.mutex.Unlock()
+
+	response, status := f.restResponse(req.Method, strings.Split(strings.Trim(path, "/"), "/"), body)
+	if status == http.StatusNoContent {
+		w.WriteHeader(status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// restResponse answers the endpoints VPBot uses, anything else gets its own
+// body back, or an empty object.
+func (f *fakeDiscord) restResponse(method string, parts []string, body []byte) (interface{}, int) {
+	route := method + " " + strings.Join(parts, "/")
+	switch {
+	case method == "GET" && (route == "GET gateway" || route == "GET gateway/bot"):
+		return map[string]string{"url": "ws" + strings.TrimPrefix(f.server.URL, "http") + "/gateway-ws"}, http.StatusOK
+
+	case route == "GET users/@me":
+		return f.botUser, http.StatusOK
+
+	case route == "POST users/@me/channels":
+		var data struct {
+			RecipientID string `json:"recipient_id"`
+		}
+		_ = json.Unmarshal(body, &data)
+		return &discordgo.Channel{ID: "dm-" + data.RecipientID, Type: discordgo.ChannelTypeDM}, http.StatusOK
+
+	case method == "GET" && len(parts) == 2 && parts[0] == "users":
+		if member := f.findMember("", parts[1]); member != nil {
+			return member.User, http.StatusOK
+		}
+		return map[string]string{"message": "Unknown User"}, http.StatusNotFound
+
+	case method == "GET" && len(parts) == 4 && parts[0] == "guilds" && parts[2] == "members":
+		if member := f.findMember(parts[1], parts[3]); member != nil {
+			return member, http.StatusOK
+		}
+		return map[string]string{"message": "Unknown Member"}, http.StatusNotFound
+
+	case method == "POST" && len(parts) == 3 && parts[0] == "channels" && parts[2] == "messages":
+		m := &discordgo.Message{}
+		_ = json.Unmarshal(body, m)
+		m.ID = f.newID()
+		m.ChannelID = parts[1]
+		m.Author = f.botUser
+		m.Timestamp = time.Now().UTC()
+
+		f.mutex.Lock()
+		f.messages[m.ID] = m
+		f.mutex.Unlock()
+		return m, http.StatusOK
+
+	case method == "GET" && len(parts) == 4 && parts[0] == "channels" && parts[2] == "messages":
+		f.mutex.Lock()
+		m, ok := f.messages[parts[3]]
+		f.mutex.Unlock()
+		if ok {
+			return m, http.StatusOK
+		}
+		return map[string]string{"message": "Unknown Message"}, http.StatusNotFound
+
+	case method == "PATCH" && len(parts) == 4 && parts[0] == "channels" && parts[2] == "messages":
+		f.mutex.Lock()
+		defer f.mutex.Unlock()
+		m, ok := f.messages[parts[3]]
+		if !ok {
+			return map[string]string{"message": "Unknown Message"}, http.StatusNotFound
+		}
+		// Fields left out of the edit keep their value
+		_ = json.Unmarshal(body, m)
+		m.ID = parts[3]
+		return m, http.StatusOK
+
+	case method == "PUT" && len(parts) == 7 && parts[0] == "channels" && parts[4] == "reactions":
+		return nil, http.StatusNoContent
+
+	case method == "PUT" && len(parts) == 4 && parts[0] == "guilds" && parts[2] == "bans":
+		return nil, http.StatusNoContent
+
+	case method == "DELETE":
+		return nil, http.StatusNoContent
+	}
+
+	if len(body) > 0 && json.Valid(body) {
+		return json.RawMessage(body), http.StatusOK
+	}
+	return map[string]string{}, http.StatusOK
+}
+
+func (f *fakeDiscord) findMember(guildID string, userID string) *discordgo.Member {
+	for _, g := range f.guilds {
+		if len(guildID) > 0 && g.ID != guildID {
+			continue
+		}
+		for _, m := range g.Members {
+			if m.User != nil && m.User.ID == userID {
+				return m
+			}
+		}
+	}
+	return nil
+}
+
+// serveGateway speaks just enough of the gateway protocol for discordgo:
+// Hello, READY and a GUILD_CREATE per guild after Identify, and heartbeat ACKs.
+func (f *fakeDiscord) serveGateway(w http.ResponseWriter, req *http.Request) {
+	upgrader := websocket.Upgrader{}
+	ws, err := upgrader.Upgrade(w, req, nil)
+	if err != nil {
+		log.Printf("Fake gateway couldn't upgrade connection: %s", err)
+		return
+	}
+	defer ws.Close()
+
+	f.wsMutex.Lock()
+	f.ws = ws
+	f.sequence = 0
+	err = ws.WriteJSON(map[string]interface{}{"op": 10, "d": map[string]int{"heartbeat_interval": 45000}})
+	f.wsMutex.Unlock()
+	if err != nil {
+		return
+	}
+
+	for {
+		var payload struct {
+			Op int `json:"op"`
+		}
+		if err := ws.ReadJSON(&payload); err != nil {
+			return
+		}
+
+		switch payload.Op {
+		case 1:
+			f.wsMutex.Lock()
+			err = ws.WriteJSON(map[string]interface{}{"op": 11})
+			f.wsMutex.Unlock()
+		case 2:
+			err = f.sendReady()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeDiscord) sendReady() error {
+	unavailable := make([]map[string]interface{}, 0, len(f.guilds))
+	for _, g := range f.guilds {
+		unavailable = append(unavailable, map[string]interface{}{"id": g.ID, "unavailable": true})
+	}
+
+	err := f.dispatch("READY", map[string]interface{}{
+		"v":          10,
+		"user":       f.botUser,
+		"session_id": "fake",
+		"guilds":     unavailable,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, g := range f.guilds {
+		if err := f.dispatch("GUILD_CREATE", g); err != nil {
+			return err
+		}
+	}
+
+	select {
+	case <-f.ready:
+	default:
+		close(f.ready)
+	}
+	return nil
+}
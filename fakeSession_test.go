@@ -0,0 +1,274 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// fakeCall is a call made to a fakeSession, args are the arguments without
+// the request options.
+type fakeCall struct {
+	method string
+	args   []interface{}
+}
+
+// fakeSession is a discordSession that records every call instead of talking
+// to Discord, for running handlers offline. Guilds, channels and members are
+// looked up in its state, messages it sends can be fetched again.
+type fakeSession struct {
+	mutex sync.Mutex
+	st    *discordgo.State
+
+	calls    []fakeCall
+	messages map[string]*discordgo.Message
+	nextID   int
+
+	// permissions are returned by UserChannelPermissions, keyed by user ID
+	permissions map[string]int64
+	// errs makes calls to a method fail, keyed by method name
+	errs map[string]error
+}
+
+// newFakeSession creates a fakeSession logged in as botUser.
+func newFakeSession(botUser *discordgo.User) *fakeSession {
+	st := discordgo.NewState()
+	st.User = botUser
+	st.Ready = discordgo.Ready{User: botUser}
+
+	return &fakeSession{
+		st:          st,
+		messages:    make(map[string]*discordgo.Message),
+		nextID:      1000,
+		permissions: make(map[string]int64),
+		errs:        make(map[string]error),
+	}
+}
+
+func (f *fakeSession) state() *discordgo.State {
+	return f.st
+}
+
+// failWith makes every following call to method return err.
+func (f *fakeSession) failWith(method string, err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.errs[method] = err
+}
+
+// callsTo returns the calls made to method, in order.
+func (f *fakeSession) callsTo(method string) []fakeCall {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	result := make([]fakeCall, 0)
+	for _, c := range f.calls {
+		if c.method == method {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// sentTo returns the messages sent to the channel, in order.
+func (f *fakeSession) sentTo(channelID string) []*discordgo.Message {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	result := make([]*discordgo.Message, 0)
+	for _, c := range f.calls {
+		if c.method != "ChannelMessageSend" && c.method != "ChannelMessageSendComplex" {
+			continue
+		}
+		if c.args[0] == channelID {
+			if m, ok := f.messages[c.args[len(c.args)-1].(string)]; ok {
+				result = append(result, m)
+			}
+		}
+	}
+	return result
+}
+
+func (f *fakeSession) record(method string, args ...interface{}) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.calls = append(f.calls, fakeCall{method, args})
+	return f.errs[method]
+}
+
+func (f *fakeSession) newID() string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.nextID++
+	return strconv.Itoa(f.nextID)
+}
+
+func (f *fakeSession) storeMessage(channelID string, data *discordgo.MessageSend) *discordgo.Message {
+	m := &discordgo.Message{
+		ID:         f.newID(),
+		ChannelID:  channelID,
+		Content:    data.Content,
+		Embeds:     data.Embeds,
+		Components: data.Components,
+		Author:     f.st.User,
+	}
+	if c, err := f.st.Channel(channelID); err == nil {
+		m.GuildID = c.GuildID
+	}
+
+	f.mutex.Lock()
+	f.messages[m.ID] = m
+	f.mutex.Unlock()
+	return m
+}
+
+func (f *fakeSession) Channel(channelID string, _ ...discordgo.RequestOption) (*discordgo.Channel, error) {
+	if err := f.record("Channel", channelID); err != nil {
+		return nil, err
+	}
+	return f.st.Channel(channelID)
+}
+
+func (f *fakeSession) ChannelMessage(channelID string, messageID string, _ ...discordgo.RequestOption) (*discordgo.Message, error) {
+	if err := f.record("ChannelMessage", channelID, messageID); err != nil {
+		return nil, err
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if m, ok := f.messages[messageID]; ok && m.ChannelID == channelID {
+		return m, nil
+	}
+	return nil, fmt.Errorf("unknown message %s in channel %s", messageID, channelID)
+}
+
+func (f *fakeSession) ChannelMessageSend(channelID string, content string, _ ...discordgo.RequestOption) (*discordgo.Message, error) {
+	if err := f.errs["ChannelMessageSend"]; err != nil {
+		f.record("ChannelMessageSend", channelID, content, "")
+		return nil, err
+	}
+
+	m := f.storeMessage(channelID, &discordgo.MessageSend{Content: content})
+	f.record("ChannelMessageSend", channelID, content, m.ID)
+	return m, nil
+}
+
+func (f *fakeSession) ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend, _ ...discordgo.RequestOption) (*discordgo.Message, error) {
+	if err := f.errs["ChannelMessageSendComplex"]; err != nil {
+		f.record("ChannelMessageSendComplex", channelID, data, "")
+		return nil, err
+	}
+
+	m := f.storeMessage(channelID, data)
+	f.record("ChannelMessageSendComplex", channelID, data, m.ID)
+	return m, nil
+}
+
+func (f *fakeSession) ChannelMessageEditComplex(edit *discordgo.MessageEdit, _ ...discordgo.RequestOption) (*discordgo.Message, error) {
+	if err := f.record("ChannelMessageEditComplex", edit); err != nil {
+		return nil, err
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	m, ok := f.messages[edit.ID]
+	if !ok || m.ChannelID != edit.Channel {
+		return nil, fmt.Errorf("unknown message %s in channel %s", edit.ID, edit.Channel)
+	}
+	if edit.Content != nil {
+		m.Content = *edit.Content
+	}
+	if edit.Embeds != nil {
+		m.Embeds = *edit.Embeds
+	}
+	if edit.Components != nil {
+		m.Components = *edit.Components
+	}
+	return m, nil
+}
+
+func (f *fakeSession) ChannelMessageDelete(channelID string, messageID string, _ ...discordgo.RequestOption) error {
+	if err := f.record("ChannelMessageDelete", channelID, messageID); err != nil {
+		return err
+	}
+
+	f.mutex.Lock()
+	delete(f.messages, messageID)
+	f.mutex.Unlock()
+	return nil
+}
+
+func (f *fakeSession) MessageReactionAdd(channelID string, messageID string, emojiID string, _ ...discordgo.RequestOption) error {
+	return f.record("MessageReactionAdd", channelID, messageID, emojiID)
+}
+
+func (f *fakeSession) User(userID string, _ ...discordgo.RequestOption) (*discordgo.User, error) {
+	if err := f.record("User", userID); err != nil {
+		return nil, err
+	}
+
+	f.st.RLock()
+	defer f.st.RUnlock()
+	for _, g := range f.st.Guilds {
+		for _, m := range g.Members {
+			if m.User != nil && m.User.ID == userID {
+				return m.User, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("unknown user %s", userID)
+}
+
+func (f *fakeSession) UserChannelCreate(recipientID string, _ ...discordgo.RequestOption) (*discordgo.Channel, error) {
+	if err := f.record("UserChannelCreate", recipientID); err != nil {
+		return nil, err
+	}
+	return &discordgo.Channel{ID: "dm-" + recipientID, Type: discordgo.ChannelTypeDM}, nil
+}
+
+func (f *fakeSession) UserChannelPermissions(userID string, channelID string, _ ...discordgo.RequestOption) (int64, error) {
+	if err := f.record("UserChannelPermissions", userID, channelID); err != nil {
+		return 0, err
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.permissions[userID], nil
+}
+
+func (f *fakeSession) GuildMember(guildID string, userID string, _ ...discordgo.RequestOption) (*discordgo.Member, error) {
+	if err := f.record("GuildMember", guildID, userID); err != nil {
+		return nil, err
+	}
+	return f.st.Member(guildID, userID)
+}
+
+func (f *fakeSession) GuildBanCreateWithReason(guildID string, userID string, reason string, days int, _ ...discordgo.RequestOption) error {
+	return f.record("GuildBanCreateWithReason", guildID, userID, reason, days)
+}
+
+func (f *fakeSession) InteractionRespond(interaction *discordgo.Interaction, resp *discordgo.InteractionResponse, _ ...discordgo.RequestOption) error {
+	return f.record("InteractionRespond", interaction, resp)
+}
+
+func (f *fakeSession) FollowupMessageCreate(interaction *discordgo.Interaction, wait bool, data *discordgo.WebhookParams, _ ...discordgo.RequestOption) (*discordgo.Message, error) {
+	if err := f.record("FollowupMessageCreate", interaction, wait, data); err != nil {
+		return nil, err
+	}
+	return f.storeMessage(interaction.ChannelID, &discordgo.MessageSend{Content: data.Content, Embeds: data.Embeds, Components: data.Components}), nil
+}
+
+func (f *fakeSession) ApplicationCommandBulkOverwrite(appID string, guildID string, commands []*discordgo.ApplicationCommand, _ ...discordgo.RequestOption) ([]*discordgo.ApplicationCommand, error) {
+	if err := f.record("ApplicationCommandBulkOverwrite", appID, guildID, commands); err != nil {
+		return nil, err
+	}
+	return commands, nil
+}
+
+func (f *fakeSession) UpdateStatusComplex(usd discordgo.UpdateStatusData) error {
+	return f.record("UpdateStatusComplex", usd)
+}
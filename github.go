@@ -6,16 +6,23 @@ import (
 	"log"
 	"math/rand"
 	"net/http"
-	"os"
 	"regexp"
 
 	"github.com/bwmarrin/discordgo"
+	"github.com/go-co-op/gocron"
 )
 
+const githubModuleName = "github"
+
 var (
-	shurrupRegex  *regexp.Regexp
-	githubChannel *discordgo.Channel
-	githubMentionRole *discordgo.Role
+	githubModule = &module{
+		name:           githubModuleName,
+		description:    "Report failing CI jobs from the GitHub webhook",
+		defaultEnabled: true,
+		setup:          setupGithubModule,
+	}
+
+	shurrupRegex *regexp.Regexp
 
 	snarkyComeback = []string{
 		"Well if you wouldn't keep breaking it, I wouldn't have to yell at you!",
@@ -29,37 +36,14 @@ var (
 
 const shurrupRegexString = "(?i)shurrup"
 
-func initGithubChannel(s *discordgo.Session) {
-	channelId := os.Getenv("VPBOT_GITHUB_CHANNEL")
-	MentionRoleId := os.Getenv("VPBOT_GITHUB_MENTION_ROLE")
-
-	if len(channelId) <= 0 {
-		return
-	}
-
-	var err error
-	githubChannel, err = s.Channel(channelId)
-
-	if err != nil {
-		log.Printf("Couldn't find the github channel with ID: %s, %s", channelId, err)
-		return
-	}
-
-	githubMentionRole, err = s.State.Role(guildID, MentionRoleId)
-	if err != nil {
-		log.Printf("Couldn't find the github mention role with ID: %s %s", MentionRoleId, err)
-		githubChannel = nil
-		return
-	}
-
+func setupGithubModule(m *module, _ *storage, _ *gocron.Scheduler) {
 	shurrupRegex, _ = regexp.Compile(shurrupRegexString)
+
+	m.addStreamHandler(msgStreamGithubMessageHandler)
+	m.handleHTTP("/github-webhook", githubWebhookHandler)
 }
 
 func githubWebhookHandler(w http.ResponseWriter, req *http.Request) {
-	if githubChannel == nil {
-		return
-	}
-
 	event := req.Header.Get("X-Github-Event")
 	if event != "check_run" {
 		return
@@ -90,13 +74,25 @@ func githubWebhookHandler(w http.ResponseWriter, req *http.Request) {
 	url := unwrapJson(data, "check_run", "details_url").(string)
 	commitSha := unwrapJson(data, "check_run", "check_suite", "head_sha").(string)
 
-	msg := fmt.Sprintf("CI job '%s' is failing again... Somebody messed up... Wonder who... *eyes BDFL* (commit: %s) %s\n Link: <%s>",
-		jobName,
-		commitSha,
-		githubMentionRole.Mention(),
-		url)
+	for _, guildID := range connectedGuildIDs(botSession) {
+		channelID := guildConfigGet(guildID, configGithubChannel)
+		if len(channelID) <= 0 || moduleEnabledByName(guildID, githubModuleName) == false {
+			continue
+		}
+
+		mention := ""
+		if role, err := botSession.state().Role(guildID, guildConfigGet(guildID, configGithubMentionRole)); err == nil {
+			mention = role.Mention()
+		}
+
+		msg := fmt.Sprintf("CI job '%s' is failing again... Somebody messed up... Wonder who... *eyes BDFL* (commit: %s) %s\n Link: <%s>",
+			jobName,
+			commitSha,
+			mention,
+			url)
 
-	discord.ChannelMessageSend(githubChannel.ID, msg)
+		botSession.ChannelMessageSend(channelID, msg)
+	}
 }
 
 func unwrapJson(obj map[string]interface{}, keys ...string) interface{} {
@@ -111,12 +107,9 @@ func unwrapJson(obj map[string]interface{}, keys ...string) interface{} {
 	return root
 }
 
-func msgStreamGithubMessageHandler(session *discordgo.Session, msg *discordgo.MessageCreate) {
-	if githubChannel == nil {
-		return
-	}
-
-	if msg.ChannelID != githubChannel.ID {
+func msgStreamGithubMessageHandler(session discordSession, msg *discordgo.MessageCreate) {
+	githubChannelID := guildConfigGet(msg.GuildID, configGithubChannel)
+	if len(githubChannelID) <= 0 || msg.ChannelID != githubChannelID {
 		return
 	}
 
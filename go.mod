@@ -3,11 +3,10 @@ module vpbot
 go 1.13
 
 require (
-	github.com/bwmarrin/discordgo v0.23.2
+	github.com/bwmarrin/discordgo v0.28.1
 	github.com/go-co-op/gocron v1.5.0
+	github.com/gorilla/websocket v1.4.2
 	github.com/lib/pq v1.10.7
 	github.com/mattn/go-sqlite3 v1.14.7
 	github.com/mb-14/gomarkov v0.0.0-20210216094942-a5b484cc0243
-	golang.org/x/crypto v0.0.0-20190308221718-c2843e01d9a2 // indirect
-	golang.org/x/sys v0.0.0-20190412213103-97732733099d // indirect
 )
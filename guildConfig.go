@@ -0,0 +1,296 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Keys of the per guild settings stored in guild_config
+const (
+	configModChannel        = "mod.channel"
+	configAuditChannel      = "audit.channel"
+	configPoliceChannel     = "police.channel"
+	configPoliceGracePeriod = "police.grace_period"
+	configIdeasChannel      = "ideas.channel"
+	configIdeasQueueChannel = "ideas.queue_channel"
+	configGithubChannel     = "github.channel"
+	configGithubMentionRole = "github.mention_role"
+	configUserTrackChannel  = "usertrack.channel"
+)
+
+type configKey struct {
+	key         string
+	description string
+	// kind is what values of the key have to be, argChannel, argRole or
+	// argDuration
+	kind argKind
+}
+
+// configKeys are the settings that can be changed with !config
+var configKeys = []configKey{
+	{configModChannel, "Channel VPBot reports automatic moderation actions in", argChannel},
+	{configAuditChannel, "Channel every moderation action is logged in, automatic or not", argChannel},
+	{configPoliceChannel, "Showcase channel where messages without a link or file are deleted, unless it has !police rules", argChannel},
+	{configPoliceGracePeriod, "How long people get to add a missing link or file before their message is deleted, like 1m", argDuration},
+	{configIdeasChannel, "Channel approved ideas are posted in", argChannel},
+	{configIdeasQueueChannel, "Channel mods review suggested ideas in", argChannel},
+	{configGithubChannel, "Channel failing CI jobs are reported in", argChannel},
+	{configGithubMentionRole, "Role mentioned when a CI job fails", argRole},
+	{configUserTrackChannel, "Channel the weekly user count is posted in", argChannel},
+}
+
+// legacyConfigEnv maps the environment variables used before settings were
+// stored per guild to the keys they're imported as for VPBOT_GUILD_ID
+var legacyConfigEnv = map[string]string{
+	"VPBOT_MOD_CHAN_ID":         configModChannel,
+	"VPBOT_POLICE_CHANNEL":      configPoliceChannel,
+	"VPBOT_IDEAS_CHANNEL":       configIdeasChannel,
+	"VPBOT_MOD_QUEUE_CHANNEL":   configIdeasQueueChannel,
+	"VPBOT_GITHUB_CHANNEL":      configGithubChannel,
+	"VPBOT_GITHUB_MENTION_ROLE": configGithubMentionRole,
+	"VPBOT_USERTRACK_CHANNEL":   configUserTrackChannel,
+}
+
+var (
+	queryGuildConfig  *sql.Stmt
+	upsertGuildConfig *sql.Stmt
+	deleteGuildConfig *sql.Stmt
+
+	guildConfigMutex sync.RWMutex
+	// guildConfigCache holds the settings of every guild looked up so far
+	guildConfigCache = make(map[string]map[string]string)
+)
+
+func initGuildConfig(db *storage) {
+	queryGuildConfig = dbPrepare(db, "SELECT key, value FROM guild_config WHERE guild_id = $1")
+	upsertGuildConfig = dbPrepare(db,
+		"INSERT INTO guild_config (guild_id, key, value) VALUES ($1, $2, $3) ON CONFLICT (guild_id, key) DO UPDATE SET value = excluded.value")
+	deleteGuildConfig = dbPrepare(db, "DELETE FROM guild_config WHERE guild_id = $1 AND key = $2")
+
+	importLegacyConfig()
+}
+
+// importLegacyConfig copies settings from the environment into the config of
+// VPBOT_GUILD_ID, without overwriting anything already set there.
+func importLegacyConfig() {
+	if len(guildID) <= 0 {
+		return
+	}
+
+	for env, key := range legacyConfigEnv {
+		value := os.Getenv(env)
+		if len(value) <= 0 || len(guildConfigGet(guildID, key)) > 0 {
+			continue
+		}
+
+		log.Printf("Importing %s as %s for guild %s", env, key, guildID)
+		if err := guildConfigSet(guildID, key, value); err != nil {
+			log.Printf("Error trying to import %s: %s", env, err)
+		}
+	}
+}
+
+func loadGuildConfig(guildID string) map[string]string {
+	guildConfigMutex.RLock()
+	config, ok := guildConfigCache[guildID]
+	guildConfigMutex.RUnlock()
+	if ok {
+		return config
+	}
+
+	rows, err := queryGuildConfig.Query(guildID)
+	if err != nil {
+		// Don't cache, so we try again next time
+		log.Printf("Error trying to get config for guild %s: %s", guildID, err)
+		return map[string]string{}
+	}
+	defer rows.Close()
+
+	config = make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			log.Printf("Error trying to read config for guild %s: %s", guildID, err)
+			continue
+		}
+		config[key] = value
+	}
+
+	guildConfigMutex.Lock()
+	guildConfigCache[guildID] = config
+	guildConfigMutex.Unlock()
+
+	return config
+}
+
+// guildConfigGet returns the setting for the guild, or an empty string if
+// it isn't set.
+func guildConfigGet(guildID string, key string) string {
+	if len(guildID) <= 0 {
+		return ""
+	}
+
+	config := loadGuildConfig(guildID)
+
+	guildConfigMutex.RLock()
+	defer guildConfigMutex.RUnlock()
+	return config[key]
+}
+
+func guildConfigSet(guildID string, key string, value string) error {
+	_, err := upsertGuildConfig.Exec(guildID, key, value)
+	if err != nil {
+		return err
+	}
+
+	config := loadGuildConfig(guildID)
+	guildConfigMutex.Lock()
+	config[key] = value
+	guildConfigMutex.Unlock()
+
+	return nil
+}
+
+func guildConfigUnset(guildID string, key string) error {
+	_, err := deleteGuildConfig.Exec(guildID, key)
+	if err != nil {
+		return err
+	}
+
+	config := loadGuildConfig(guildID)
+	guildConfigMutex.Lock()
+	delete(config, key)
+	guildConfigMutex.Unlock()
+
+	return nil
+}
+
+// connectedGuildIDs returns the IDs of every guild VPBot is in.
+func connectedGuildIDs(s discordSession) []string {
+	st := s.state()
+	st.RLock()
+	defer st.RUnlock()
+
+	ids := make([]string, 0, len(st.Guilds))
+	for _, g := range st.Guilds {
+		ids = append(ids, g.ID)
+	}
+	return ids
+}
+
+func findConfigKey(key string) (configKey, bool) {
+	for _, k := range configKeys {
+		if k.key == strings.ToLower(key) {
+			return k, true
+		}
+	}
+	return configKey{}, false
+}
+
+func describeConfigValue(k configKey, value string) string {
+	if len(value) <= 0 {
+		return "*not set*"
+	}
+
+	switch k.kind {
+	case argChannel:
+		return "<#" + value + ">"
+	case argRole:
+		return "<@&" + value + ">"
+	}
+	return "`" + value + "`"
+}
+
+func configListHandler(ctx *commandContext) {
+	var sb strings.Builder
+	for _, k := range configKeys {
+		sb.WriteString(fmt.Sprintf("`%s` %s\n%s\n", k.key, describeConfigValue(k, guildConfigGet(ctx.guildID, k.key)), k.description))
+	}
+
+	ctx.replyMessage(&discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{{
+		Title:       "VPBot settings",
+		Description: sb.String(),
+		Color:       helpEmbedColor,
+	}}})
+}
+
+func configGetHandler(ctx *commandContext) {
+	k, ok := findConfigKey(ctx.args.text("key"))
+	if !ok {
+		ctx.reply(fmt.Sprintf("There is no setting called `%s`, see `%sconfig list`", ctx.args.text("key"), ctx.prefix()))
+		return
+	}
+
+	ctx.reply(fmt.Sprintf("`%s` is %s", k.key, describeConfigValue(k, guildConfigGet(ctx.guildID, k.key))))
+}
+
+func configSetHandler(ctx *commandContext) {
+	k, ok := findConfigKey(ctx.args.text("key"))
+	if !ok {
+		ctx.reply(fmt.Sprintf("There is no setting called `%s`, see `%sconfig list`", ctx.args.text("key"), ctx.prefix()))
+		return
+	}
+
+	def := commandArg{name: "value", kind: k.kind}
+	resolved, err := resolveArg(ctx.session, ctx.guildID, nil, def, ctx.args.text("value"))
+	if err != nil {
+		ctx.reply(err.Error())
+		return
+	}
+
+	var value string
+	switch v := resolved.(type) {
+	case *discordgo.Channel:
+		if v.GuildID != ctx.guildID {
+			ctx.reply("The channel has to be in this server")
+			return
+		}
+		value = v.ID
+	case *discordgo.Role:
+		value = v.ID
+	default:
+		value = fmt.Sprint(v)
+	}
+
+	if err := guildConfigSet(ctx.guildID, k.key, value); err != nil {
+		log.Printf("Error trying to set %s for guild %s: %s", k.key, ctx.guildID, err)
+		ctx.reply("Couldn't save the setting, try again later")
+		return
+	}
+	auditCommand(ctx, auditConfigChanged, "", fmt.Sprintf("`%s` set to %s", k.key, describeConfigValue(k, value)))
+
+	ctx.reply(fmt.Sprintf("`%s` is now %s", k.key, describeConfigValue(k, value)))
+}
+
+func configUnsetHandler(ctx *commandContext) {
+	k, ok := findConfigKey(ctx.args.text("key"))
+	if !ok {
+		ctx.reply(fmt.Sprintf("There is no setting called `%s`, see `%sconfig list`", ctx.args.text("key"), ctx.prefix()))
+		return
+	}
+
+	if err := guildConfigUnset(ctx.guildID, k.key); err != nil {
+		log.Printf("Error trying to unset %s for guild %s: %s", k.key, ctx.guildID, err)
+		ctx.reply("Couldn't remove the setting, try again later")
+		return
+	}
+	auditCommand(ctx, auditConfigChanged, "", fmt.Sprintf("`%s` unset", k.key))
+
+	ctx.reply(fmt.Sprintf("`%s` is no longer set", k.key))
+}
+
+func configKeyAutocomplete(_ *commandContext, focused *discordgo.ApplicationCommandInteractionDataOption) []*discordgo.ApplicationCommandOptionChoice {
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, 0)
+	for _, k := range configKeys {
+		if strings.Contains(k.key, strings.ToLower(focused.StringValue())) {
+			choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: k.key, Value: k.key})
+		}
+	}
+	return choices
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	healthCheckInterval = 30 * time.Second
+	healthCheckTimeout  = 5 * time.Second
+)
+
+// healthStatus is served to anyone asking, so it never includes the error,
+// which can contain connection details.
+type healthStatus struct {
+	Database  string    `json:"database"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+var (
+	healthMutex sync.RWMutex
+	// lastHealth is the result of the latest checkHealth, served on /healthz
+	lastHealth = healthStatus{Database: "unknown"}
+)
+
+// checkHealth pings the database, it's run periodically so /healthz answers
+// right away even if the database hangs.
+func checkHealth() {
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+
+	status := healthStatus{Database: "ok", CheckedAt: time.Now().UTC()}
+	if err := db.PingContext(ctx); err != nil {
+		log.Printf("Database health check failed: %s", err)
+		status.Database = "unavailable"
+	}
+
+	healthMutex.Lock()
+	lastHealth = status
+	healthMutex.Unlock()
+}
+
+func healthHandler(w http.ResponseWriter, _ *http.Request) {
+	healthMutex.RLock()
+	status := lastHealth
+	healthMutex.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if status.Database != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(status)
+}
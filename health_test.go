@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHealthHandler(t *testing.T) {
+	s, err := openMigratedStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldDB := db
+	t.Cleanup(func() { db = oldDB })
+	db = s
+
+	tests := []struct {
+		name   string
+		closed bool
+		code   int
+		body   string
+	}{
+		{name: "ok", code: http.StatusOK, body: `"database":"ok"`},
+		{name: "database closed", closed: true, code: http.StatusServiceUnavailable, body: `"database":"unavailable"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.closed {
+				s.Close()
+			}
+			checkHealth()
+
+			w := httptest.NewRecorder()
+			healthHandler(w, httptest.NewRequest("GET", "/healthz", nil))
+			if w.Code != tt.code || !strings.Contains(w.Body.String(), tt.body) {
+				t.Errorf("got %d %s", w.Code, w.Body)
+			}
+			if strings.Contains(w.Body.String(), "closed") {
+				t.Errorf("the error was served: %s", w.Body)
+			}
+		})
+	}
+}
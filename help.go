@@ -0,0 +1,405 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	defaultCommandCategory = "General"
+	helpEmbedColor         = 0x5865F2
+	// Keep pages well below Discord's embed limits of 1024 characters per field
+	helpLinesPerPage  = 10
+	helpFieldCharsMax = 1000
+)
+
+// helpArgs are the arguments of !help, the user can be left out as commands
+// aren't user mentions
+var helpArgs = []commandArg{
+	{name: "user", description: "User to show the available commands for", kind: argUser},
+	{name: "command", description: "Only show help for this command", kind: argText, autocomplete: true},
+}
+
+type helpPage struct {
+	categories []string
+	lines      map[string][]string
+}
+
+func helpHandler(ctx *commandContext) {
+	user := ctx.author
+	if ctx.args.has("user") {
+		user = ctx.args.user("user")
+	}
+
+	if h, ok := helpCommandArg(ctx); ok {
+		ctx.replyMessage(&discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{commandHelpEmbed(ctx, h, user)}})
+		return
+	}
+
+	ctx.replyMessage(helpPageMessage(ctx, user, 0))
+}
+
+// helpCheckArgs makes sure the command asked about exists, so mentions like
+// "@VPBot help me with this" aren't taken as a command.
+func helpCheckArgs(ctx *commandContext) error {
+	if name := ctx.args.text("command"); len(name) > 0 {
+		if _, ok := helpCommandArg(ctx); !ok {
+			return fmt.Errorf("there is no command called `%s`", name)
+		}
+	}
+	return nil
+}
+
+func helpCommandArg(ctx *commandContext) (*commandHandler, bool) {
+	name := ctx.args.text("command")
+	if len(name) <= 0 {
+		return nil, false
+	}
+
+	h, ok := findCommand(strings.TrimPrefix(name, ctx.prefix()))
+	if !ok || len(h.description) <= 0 {
+		return nil, false
+	}
+	return h, true
+}
+
+// groupHelpHandler is run when a group is invoked without a subcommand.
+func groupHelpHandler(ctx *commandContext) {
+	ctx.replyMessage(&discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{commandHelpEmbed(ctx, ctx.command, ctx.author)}})
+}
+
+// helpPageButtonHandler flips between the pages of a help message, the
+// custom ID is help:<requester ID>:<user ID>:<page>
+func helpPageButtonHandler(s discordSession, i *discordgo.InteractionCreate, args []string) {
+	if len(args) != 3 {
+		return
+	}
+
+	ctx := &commandContext{
+		session:     s,
+		guildID:     i.GuildID,
+		channelID:   i.ChannelID,
+		author:      interactionUser(i),
+		interaction: i,
+	}
+
+	if ctx.author.ID != args[0] {
+		err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: fmt.Sprintf("Use `%shelp` to get your own help message", ctx.prefix()),
+				Flags:   discordgo.MessageFlagsEphemeral,
+			},
+		})
+		if err != nil {
+			log.Printf("Couldn't respond to help button: %s", err)
+		}
+		return
+	}
+
+	user, err := s.User(args[1])
+	if err != nil {
+		user = ctx.author
+	}
+	page, _ := strconv.Atoi(args[2])
+
+	msg := helpPageMessage(ctx, user, page)
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Embeds:     msg.Embeds,
+			Components: msg.Components,
+		},
+	})
+	if err != nil {
+		log.Printf("Couldn't update help message: %s", err)
+	}
+}
+
+func helpPageMessage(ctx *commandContext, user *discordgo.User, page int) *discordgo.MessageSend {
+	pages := helpPages(ctx, user)
+	if page < 0 {
+		page = 0
+	}
+	if page >= len(pages) {
+		page = len(pages) - 1
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       "VPBot commands",
+		Description: fmt.Sprintf("Commands available to %s, use `%shelp <command>` for details", user.Mention(), ctx.prefix()),
+		Color:       helpEmbedColor,
+		Footer:      &discordgo.MessageEmbedFooter{Text: fmt.Sprintf("Page %d/%d", page+1, len(pages))},
+	}
+
+	for _, category := range pages[page].categories {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  category,
+			Value: strings.Join(pages[page].lines[category], "\n"),
+		})
+	}
+
+	msg := &discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{embed}}
+	if len(pages) > 1 {
+		id := fmt.Sprintf("help:%s:%s:", ctx.author.ID, user.ID)
+		msg.Components = []discordgo.MessageComponent{
+			discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Label:    "Previous",
+					Style:    discordgo.SecondaryButton,
+					CustomID: id + strconv.Itoa(page-1),
+					Disabled: page <= 0,
+				},
+				discordgo.Button{
+					Label:    "Next",
+					Style:    discordgo.SecondaryButton,
+					CustomID: id + strconv.Itoa(page+1),
+					Disabled: page >= len(pages)-1,
+				},
+			}},
+		}
+	}
+
+	return msg
+}
+
+// helpPages splits the commands available to user into pages, grouped by
+// category with both categories and commands sorted by name.
+func helpPages(ctx *commandContext, user *discordgo.User) []helpPage {
+	byCategory := make(map[string][]*commandHandler)
+	collectVisibleCommands(ctx, newCommandAccess(ctx.session, ctx.guildID, ctx.channelID, user.ID), commandMap, byCategory)
+
+	categories := make([]string, 0, len(byCategory))
+	for category := range byCategory {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	pages := []helpPage{{lines: make(map[string][]string)}}
+	lines := 0
+	for _, category := range categories {
+		cmds := byCategory[category]
+		sort.Slice(cmds, func(i, j int) bool { return cmds[i].fullName() < cmds[j].fullName() })
+
+		chars := 0
+		for _, h := range cmds {
+			line := fmt.Sprintf("`%s` %s", commandUsage(ctx.prefix(), h), h.description)
+
+			page := &pages[len(pages)-1]
+			if lines >= helpLinesPerPage || chars+len(line) > helpFieldCharsMax {
+				pages = append(pages, helpPage{lines: make(map[string][]string)})
+				page = &pages[len(pages)-1]
+				lines, chars = 0, 0
+			}
+
+			if _, ok := page.lines[category]; !ok {
+				page.categories = append(page.categories, category)
+			}
+			page.lines[category] = append(page.lines[category], line)
+			lines++
+			chars += len(line) + 1
+		}
+	}
+
+	return pages
+}
+
+// collectVisibleCommands finds every runnable command visible to user,
+// groups aren't included themselves, only their subcommands.
+func collectVisibleCommands(ctx *commandContext, access *commandAccess, cmds map[string]*commandHandler, byCategory map[string][]*commandHandler) {
+	for _, h := range cmds {
+		if commandVisibleTo(ctx, h, access) == false {
+			continue
+		}
+
+		if len(h.subcommands) > 0 {
+			collectVisibleCommands(ctx, access, h.subcommands, byCategory)
+			continue
+		}
+
+		category := h.category
+		if len(category) <= 0 {
+			category = defaultCommandCategory
+		}
+		byCategory[category] = append(byCategory[category], h)
+	}
+}
+
+// commandHelpEmbed is the detail page for a single command or group.
+func commandHelpEmbed(ctx *commandContext, h *commandHandler, user *discordgo.User) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Title:       "`" + commandUsage(ctx.prefix(), h) + "`",
+		Description: h.description,
+		Color:       helpEmbedColor,
+	}
+
+	if len(h.category) > 0 {
+		embed.Footer = &discordgo.MessageEmbedFooter{Text: h.category}
+	}
+
+	if len(h.subcommands) > 0 {
+		access := newCommandAccess(ctx.session, ctx.guildID, ctx.channelID, user.ID)
+		lines := make([]string, 0, len(h.subcommands))
+		for _, sub := range sortedCommands(h.subcommands) {
+			if commandVisibleTo(ctx, sub, access) {
+				lines = append(lines, fmt.Sprintf("`%s` %s", commandUsage(ctx.prefix(), sub), sub.description))
+			}
+		}
+		if len(lines) > 0 {
+			embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+				Name:  "Subcommands",
+				Value: truncate(strings.Join(lines, "\n"), helpFieldCharsMax),
+			})
+		}
+	}
+
+	if len(h.args) > 0 {
+		lines := make([]string, 0, len(h.args))
+		for _, def := range h.args {
+			requirement := "optional"
+			if def.required {
+				requirement = "required"
+			}
+			lines = append(lines, fmt.Sprintf("`%s` (%s, %s) %s", def.name, argKindName(def.kind), requirement, def.description))
+		}
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  "Arguments",
+			Value: strings.Join(lines, "\n"),
+		})
+	}
+
+	if aliases := commandAliasesOf(h); len(aliases) > 0 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:   "Aliases",
+			Value:  "`" + ctx.prefix() + strings.Join(aliases, "`, `"+ctx.prefix()) + "`",
+			Inline: true,
+		})
+	}
+
+	if cooldowns := describeCooldown(h.cooldown); len(cooldowns) > 0 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:   "Cooldown",
+			Value:  cooldowns,
+			Inline: true,
+		})
+	}
+
+	embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+		Name:   "Permissions",
+		Value:  describeCommandPermissions(ctx.guildID, h),
+		Inline: true,
+	})
+
+	return embed
+}
+
+func describeCooldown(c commandCooldown) string {
+	parts := make([]string, 0, 3)
+	if c.user > 0 {
+		parts = append(parts, formatDuration(c.user)+" per user")
+	}
+	if c.channel > 0 {
+		parts = append(parts, formatDuration(c.channel)+" per channel")
+	}
+	if c.global > 0 {
+		parts = append(parts, formatDuration(c.global)+" for everyone")
+	}
+	return strings.Join(parts, "\n")
+}
+
+// describeCommandPermissions lists the rules applying to h in the guild, on
+// top of the default of it being mod only or not.
+func describeCommandPermissions(guildID string, h *commandHandler) string {
+	lines := make([]string, 0)
+	if h.modOnly {
+		lines = append(lines, "Mod only")
+	} else {
+		lines = append(lines, "Everyone")
+	}
+
+	scopes := commandPermissionScopes(h)
+	for _, p := range guildCommandPermissions(guildID) {
+		for _, scope := range scopes {
+			if p.command != scope {
+				continue
+			}
+
+			verb := "Denied"
+			if p.allow {
+				verb = "Allowed"
+			}
+			lines = append(lines, fmt.Sprintf("%s for %s (`%s`)", verb, describePermTarget(p), p.command))
+		}
+	}
+
+	return truncate(strings.Join(lines, "\n"), helpFieldCharsMax)
+}
+
+func formatDuration(d time.Duration) string {
+	switch {
+	case d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	}
+	return fmt.Sprintf("%ds", int(d.Seconds()))
+}
+
+// commandVisibleTo reports whether h should be listed in help for the user
+// access was loaded for, groups are only listed if at least one of their
+// subcommands is.
+func commandVisibleTo(ctx *commandContext, h *commandHandler, access *commandAccess) bool {
+	if len(h.description) <= 0 || moduleEnabled(ctx.guildID, commandModule(h)) == false {
+		return false
+	}
+
+	if access.allows(h) == false {
+		return false
+	}
+
+	if len(h.subcommands) <= 0 {
+		return true
+	}
+
+	for _, sub := range h.subcommands {
+		if commandVisibleTo(ctx, sub, access) {
+			return true
+		}
+	}
+	return false
+}
+
+func helpAutocomplete(ctx *commandContext, focused *discordgo.ApplicationCommandInteractionDataOption) []*discordgo.ApplicationCommandOptionChoice {
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, 0)
+	access := newCommandAccess(ctx.session, ctx.guildID, ctx.channelID, ctx.author.ID)
+	appendCommandChoices(&choices, ctx, access, commandMap, strings.ToLower(focused.StringValue()))
+
+	// Discord allows at most 25 choices
+	if len(choices) > 25 {
+		choices = choices[:25]
+	}
+	return choices
+}
+
+func appendCommandChoices(choices *[]*discordgo.ApplicationCommandOptionChoice, ctx *commandContext, access *commandAccess, cmds map[string]*commandHandler, prefix string) {
+	for _, h := range sortedCommands(cmds) {
+		if commandVisibleTo(ctx, h, access) == false {
+			continue
+		}
+
+		name := h.fullName()
+		if strings.HasPrefix(name, prefix) {
+			*choices = append(*choices, &discordgo.ApplicationCommandOptionChoice{Name: name, Value: name})
+		}
+
+		appendCommandChoices(choices, ctx, access, h.subcommands, prefix)
+	}
+}
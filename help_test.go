@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestHelpCheckArgs(t *testing.T) {
+	if _, ok := findCommand("helpchecktest"); !ok {
+		handleCommand("helpchecktest", "Command for testing help", false, func(*commandContext) {})
+	}
+
+	tests := []struct {
+		command string
+		err     bool
+	}{
+		{command: ""},
+		{command: "helpchecktest"},
+		{command: "!helpchecktest"},
+		{command: "me with math", err: true},
+	}
+
+	for _, tt := range tests {
+		// Outside a guild, so the default prefix is used without a database
+		ctx := &commandContext{args: &commandArgs{values: map[string]interface{}{}}}
+		if len(tt.command) > 0 {
+			ctx.args.values["command"] = tt.command
+		}
+
+		if err := helpCheckArgs(ctx); (err != nil) != tt.err {
+			t.Errorf("helpCheckArgs for '%s' returned %v", tt.command, err)
+		}
+	}
+}
+
+func TestHelpPagesLookUpMemberOnce(t *testing.T) {
+	useTestStorage(t)
+	for _, name := range []string{"helpmodtest", "helpmodtest2", "helpmodtest3"} {
+		if _, ok := findCommand(name); !ok {
+			handleCommand(name, "Mod only command for testing help", true, func(*commandContext) {})
+		}
+	}
+
+	f := newFakeSession(&discordgo.User{ID: "100"})
+	f.st.GuildAdd(&discordgo.Guild{ID: "10", Name: "guild", Roles: []*discordgo.Role{{ID: "50", Name: "Mod"}}})
+	user := &discordgo.User{ID: "40", Username: "someone"}
+	ctx := &commandContext{session: f, guildID: "10", channelID: "20", author: user}
+
+	for _, p := range helpPages(ctx, user) {
+		for _, lines := range p.lines {
+			if strings.Contains(strings.Join(lines, "\n"), "helpmodtest") {
+				t.Errorf("mod only commands are listed for someone without the Mod role")
+			}
+		}
+	}
+
+	if calls := len(f.callsTo("GuildMember")); calls != 1 {
+		t.Errorf("member was fetched %d times, want once", calls)
+	}
+	if calls := len(f.callsTo("UserChannelPermissions")); calls != 1 {
+		t.Errorf("permissions were looked up %d times, want once", calls)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	// ideaSimilarThreshold is how alike ideas have to be for the mods to be
+	// shown the older one as a possible duplicate
+	ideaSimilarThreshold = 0.5
+	// ideaDuplicateThreshold is how alike a new idea has to be to an approved
+	// one to be turned away, the author is sent to vote on it instead
+	ideaDuplicateThreshold = 0.8
+	// ideaSimilarLimit is how many possible duplicates are kept per idea
+	ideaSimilarLimit = 5
+)
+
+type similarIdea struct {
+	idea       *idea
+	similarity float64
+}
+
+// normalizeIdeaText lowercases the text and reduces everything that isn't a
+// letter or digit to single spaces, so punctuation and formatting don't matter
+// when comparing ideas.
+func normalizeIdeaText(text string) string {
+	var sb strings.Builder
+	space := false
+	for _, r := range strings.ToLower(text) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if space && sb.Len() > 0 {
+				sb.WriteRune(' ')
+			}
+			sb.WriteRune(r)
+			space = false
+		} else {
+			space = true
+		}
+	}
+	return sb.String()
+}
+
+// ideaSimilarity compares two normalized texts from 0 (nothing in common) to
+// 1 (the same), using the Dice coefficient of their character trigrams, which
+// copes with typos and reordered words.
+func ideaSimilarity(a string, b string) float64 {
+	if a == b {
+		return 1
+	}
+
+	ta := trigrams(a)
+	tb := trigrams(b)
+	if len(ta) <= 0 || len(tb) <= 0 {
+		return 0
+	}
+
+	shared := 0
+	for t, n := range ta {
+		if m, ok := tb[t]; ok {
+			if m < n {
+				n = m
+			}
+			shared += n
+		}
+	}
+
+	total := 0
+	for _, n := range ta {
+		total += n
+	}
+	for _, n := range tb {
+		total += n
+	}
+	return 2 * float64(shared) / float64(total)
+}
+
+func trigrams(text string) map[string]int {
+	result := make(map[string]int)
+	// Padding makes the start and end of words count as well
+	runes := []rune(" " + text + " ")
+	for i := 0; i+3 <= len(runes); i++ {
+		result[string(runes[i:i+3])]++
+	}
+	return result
+}
+
+// findSimilarIdeas returns the open ideas in the guild that look like text,
+// most alike first.
+func findSimilarIdeas(guildID string, text string) ([]similarIdea, error) {
+	open, err := ideas.listOpen(guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	normalized := normalizeIdeaText(text)
+	result := make([]similarIdea, 0)
+	for _, i := range open {
+		similarity := ideaSimilarity(normalized, normalizeIdeaText(i.content))
+		if similarity >= ideaSimilarThreshold {
+			result = append(result, similarIdea{i, similarity})
+		}
+	}
+
+	sort.SliceStable(result, func(a, b int) bool {
+		return result[a].similarity > result[b].similarity
+	})
+	if len(result) > ideaSimilarLimit {
+		result = result[:ideaSimilarLimit]
+	}
+	return result, nil
+}
+
+// similarIdeaIDs returns the IDs of the similar ideas, leaving out exclude so
+// an edited idea doesn't find itself.
+func similarIdeaIDs(similar []similarIdea, exclude int) []int {
+	result := make([]int, 0, len(similar))
+	for _, sim := range similar {
+		if sim.idea.id != exclude {
+			result = append(result, sim.idea.id)
+		}
+	}
+	return result
+}
+
+// ideaLink links to where the idea can be seen, its post once approved and
+// its queue message before that.
+func ideaLink(i *idea) string {
+	if len(i.postedMessageID) > 0 {
+		return fmt.Sprintf("https://discord.com/channels/%s/%s/%s", i.guildID, i.postedChannelID, i.postedMessageID)
+	}
+	if len(i.queueMessageID) > 0 {
+		return fmt.Sprintf("https://discord.com/channels/%s/%s/%s", i.guildID, i.queueChannelID, i.queueMessageID)
+	}
+	return ""
+}
+
+// describeSimilarIdeas lists the ideas an idea looked like for the mod queue.
+func describeSimilarIdeas(i *idea) string {
+	var sb strings.Builder
+	for _, id := range i.similarIDs {
+		similar, err := ideas.get(i.guildID, id)
+		if err != nil {
+			continue
+		}
+
+		title := fmt.Sprintf("#%d", similar.id)
+		if link := ideaLink(similar); len(link) > 0 {
+			title = fmt.Sprintf("[#%d](%s)", similar.id, link)
+		}
+		sb.WriteString(fmt.Sprintf("%s %s: %s\n", title, similar.status, truncate(similar.content, 80)))
+	}
+	return sb.String()
+}
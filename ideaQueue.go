@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// The mod queue shows each idea as an embed with buttons to review it, the
+// buttons and the modals they open have custom IDs like "idea:<action>:<id>".
+const ideaQueueComponentPrefix = "idea"
+
+var (
+	// ideaApproveCommand and ideaRejectCommand decide who may use the
+	// buttons and reactions, so permission rules for the commands apply to
+	// them as well
+	ideaApproveCommand *commandHandler
+	ideaRejectCommand  *commandHandler
+)
+
+// ideaQueueMessage renders the idea for the mod queue, pending ideas get
+// Approve, Reject and Edit buttons.
+func ideaQueueMessage(i *idea) *discordgo.MessageSend {
+	color := helpEmbedColor
+	switch i.status {
+	case ideaApproved, ideaImplemented:
+		color = ideaApprovedColor
+	case ideaRejected:
+		color = ideaRejectedColor
+	case ideaWithdrawn:
+		color = ideaWithdrawnColor
+	}
+
+	fields := []*discordgo.MessageEmbedField{
+		{Name: "Suggested by", Value: fmt.Sprintf("<@%s>", i.authorID), Inline: true},
+		{Name: "Status", Value: string(i.status), Inline: true},
+	}
+	if !i.reviewedAt.IsZero() {
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:   "Reviewed",
+			Value:  fmt.Sprintf("%s by <@%s>", discordTimestamp(i.reviewedAt), i.reviewerID),
+			Inline: true,
+		})
+	}
+	if len(i.reviewReason) > 0 {
+		fields = append(fields, &discordgo.MessageEmbedField{Name: "Reason", Value: i.reviewReason})
+	}
+	if len(i.attachmentURLs) > 0 {
+		fields = append(fields, &discordgo.MessageEmbedField{Name: "Files", Value: describeIdeaAttachments(i)})
+	}
+	if len(i.similarIDs) > 0 {
+		if similar := describeSimilarIdeas(i); len(similar) > 0 {
+			fields = append(fields, &discordgo.MessageEmbedField{Name: "Possible duplicates", Value: similar})
+		}
+	}
+
+	// An empty list removes the buttons when editing
+	components := []discordgo.MessageComponent{}
+	if i.status == ideaPending {
+		components = append(components, discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.Button{Label: "Approve", Style: discordgo.SuccessButton, CustomID: ideaQueueCustomID("approve", i)},
+			discordgo.Button{Label: "Reject", Style: discordgo.DangerButton, CustomID: ideaQueueCustomID("reject", i)},
+			discordgo.Button{Label: "Edit", Style: discordgo.SecondaryButton, CustomID: ideaQueueCustomID("edit", i)},
+		}})
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       fmt.Sprintf("Idea #%d", i.id),
+		Description: i.content,
+		Fields:      fields,
+		Color:       color,
+	}
+	// Embeds can show one image, the rest are linked
+	for _, url := range i.attachmentURLs {
+		if isImageURL(url) {
+			embed.Image = &discordgo.MessageEmbedImage{URL: url}
+			break
+		}
+	}
+
+	return &discordgo.MessageSend{
+		Embeds:     []*discordgo.MessageEmbed{embed},
+		Components: components,
+	}
+}
+
+// describeIdeaAttachments links the files uploaded with the idea by name.
+func describeIdeaAttachments(i *idea) string {
+	var sb strings.Builder
+	for _, url := range i.attachmentURLs {
+		name := path.Base(strings.SplitN(url, "?", 2)[0])
+		sb.WriteString(fmt.Sprintf("[%s](%s)\n", name, url))
+	}
+	return sb.String()
+}
+
+func isImageURL(url string) bool {
+	switch strings.ToLower(path.Ext(strings.SplitN(url, "?", 2)[0])) {
+	case ".png", ".jpg", ".jpeg", ".gif", ".webp":
+		return true
+	}
+	return false
+}
+
+func ideaQueueCustomID(action string, i *idea) string {
+	return fmt.Sprintf("%s:%s:%d", ideaQueueComponentPrefix, action, i.id)
+}
+
+// updateIdeaQueueMessage renders the idea's queue message again after it
+// changed.
+func updateIdeaQueueMessage(s discordSession, i *idea) {
+	if len(i.queueMessageID) <= 0 {
+		return
+	}
+
+	msg := ideaQueueMessage(i)
+	_, err := s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+		ID:         i.queueMessageID,
+		Channel:    i.queueChannelID,
+		Embeds:     &msg.Embeds,
+		Components: &msg.Components,
+	})
+	if err != nil {
+		log.Printf("Error trying to update the queue message of idea #%d: %s", i.id, err)
+	}
+}
+
+// ideaQueueButtonHandler opens the modal for the button that was pressed,
+// asking for a reason when reviewing and the new text when editing.
+func ideaQueueButtonHandler(s discordSession, i *discordgo.InteractionCreate, args []string) {
+	found, ok := reviewableIdea(s, i, args)
+	if !ok {
+		return
+	}
+
+	var title string
+	var input discordgo.TextInput
+	switch args[0] {
+	case "approve", "reject":
+		title = fmt.Sprintf("Approve idea #%d", found.id)
+		if args[0] == "reject" {
+			title = fmt.Sprintf("Reject idea #%d", found.id)
+		}
+		input = discordgo.TextInput{
+			CustomID:    "reason",
+			Label:       "Reason",
+			Style:       discordgo.TextInputParagraph,
+			Placeholder: "Optional, this is sent to the author",
+			MaxLength:   1000,
+		}
+	case "edit":
+		title = fmt.Sprintf("Edit idea #%d", found.id)
+		input = discordgo.TextInput{
+			CustomID:  "content",
+			Label:     "Idea",
+			Style:     discordgo.TextInputParagraph,
+			Value:     found.content,
+			Required:  true,
+			MaxLength: 2000,
+		}
+	}
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseModal,
+		Data: &discordgo.InteractionResponseData{
+			CustomID:   ideaQueueCustomID(args[0], found),
+			Title:      title,
+			Components: []discordgo.MessageComponent{discordgo.ActionsRow{Components: []discordgo.MessageComponent{input}}},
+		},
+	})
+	if err != nil {
+		log.Printf("Couldn't open the %s modal for idea #%d: %s", args[0], found.id, err)
+	}
+}
+
+// ideaQueueModalHandler reviews or edits the idea once its modal is submitted.
+func ideaQueueModalHandler(s discordSession, i *discordgo.InteractionCreate, args []string) {
+	found, ok := reviewableIdea(s, i, args)
+	if !ok {
+		return
+	}
+	data := i.ModalSubmitData()
+	user := interactionUser(i)
+
+	if args[0] == "edit" && len(strings.TrimSpace(modalValue(data, "content"))) <= 0 {
+		respondEphemeral(s, i, "An idea can't be empty")
+		return
+	}
+
+	// Approving posts the idea and DMs the author, which can take longer than
+	// Discord waits for a response
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{Type: discordgo.InteractionResponseDeferredMessageUpdate})
+	if err != nil {
+		log.Printf("Couldn't respond to the %s modal for idea #%d: %s", args[0], found.id, err)
+	}
+
+	switch args[0] {
+	case "approve":
+		err = approveIdea(s, found, user.ID, strings.TrimSpace(modalValue(data, "reason")))
+	case "reject":
+		err = rejectIdea(s, found, user.ID, strings.TrimSpace(modalValue(data, "reason")))
+	case "edit":
+		found.content = strings.TrimSpace(modalValue(data, "content"))
+		err = ideas.edit(found)
+		if err == errNotFound {
+			err = fmt.Errorf("someone else reviewed it first")
+		} else if err == nil {
+			announceIdeaEdit(s, found, user.ID)
+		}
+	}
+	if err != nil {
+		log.Printf("Error trying to %s idea #%d: %s", args[0], found.id, err)
+		_, err = s.FollowupMessageCreate(i.Interaction, false, &discordgo.WebhookParams{
+			Content: fmt.Sprintf("Couldn't %s idea #%d: %s", args[0], found.id, err),
+			Flags:   discordgo.MessageFlagsEphemeral,
+		})
+		if err != nil {
+			log.Printf("Couldn't send followup for idea #%d: %s", found.id, err)
+		}
+	}
+}
+
+// reviewableIdea loads the idea a queue button or modal is for, making sure
+// the user may review it and it's still pending. It responds if not.
+func reviewableIdea(s discordSession, i *discordgo.InteractionCreate, args []string) (*idea, bool) {
+	if len(args) != 2 || (args[0] != "approve" && args[0] != "reject" && args[0] != "edit") {
+		return nil, false
+	}
+	if moduleEnabledByName(i.GuildID, ideasModuleName) == false {
+		respondEphemeral(s, i, "The ideas module is disabled in this server")
+		return nil, false
+	}
+
+	cmd := ideaApproveCommand
+	if args[0] == "reject" {
+		cmd = ideaRejectCommand
+	}
+	if !commandAllowed(s, i.GuildID, i.ChannelID, interactionUser(i).ID, cmd) {
+		respondEphemeral(s, i, "You're not allowed to review ideas")
+		return nil, false
+	}
+
+	id, _ := strconv.Atoi(args[1])
+	found, err := ideas.get(i.GuildID, id)
+	if err != nil {
+		log.Printf("Error trying to load idea #%d: %s", id, err)
+		respondEphemeral(s, i, fmt.Sprintf("Couldn't load idea #%d", id))
+		return nil, false
+	}
+	if found.status != ideaPending {
+		respondEphemeral(s, i, fmt.Sprintf("Idea #%d has already been reviewed, it's %s", found.id, found.status))
+		return nil, false
+	}
+	return found, true
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ideaStatus is where an idea is in review, ideas start out pending.
+type ideaStatus string
+
+const (
+	ideaPending     ideaStatus = "pending"
+	ideaApproved    ideaStatus = "approved"
+	ideaRejected    ideaStatus = "rejected"
+	ideaImplemented ideaStatus = "implemented"
+	// ideaWithdrawn ideas were taken back by their author before review
+	ideaWithdrawn ideaStatus = "withdrawn"
+)
+
+type idea struct {
+	id       int
+	guildID  string
+	authorID string
+	content  string
+	// attachmentURLs are the files uploaded with the idea
+	attachmentURLs []string
+	status         ideaStatus
+	createdAt      time.Time
+	updatedAt      time.Time
+
+	// reviewerID is the mod who approved or rejected the idea, reviewedAt is
+	// zero until then
+	reviewerID   string
+	reviewedAt   time.Time
+	reviewReason string
+
+	// queueChannelID and queueMessageID are the idea's message in the mod queue
+	queueChannelID string
+	queueMessageID string
+	// postedChannelID and postedMessageID are set once it's posted in the
+	// ideas channel
+	postedChannelID string
+	postedMessageID string
+
+	// similarIDs are the ideas this one looked like when it was suggested
+	similarIDs []int
+}
+
+// ideaStore keeps every idea suggested with !idea add.
+type ideaStore interface {
+	// add stores the idea as pending and sets its ID
+	add(i *idea) error
+	// get returns errNotFound if there is no idea with the ID in the guild
+	get(guildID string, id int) (*idea, error)
+	// getByQueueMessage finds the idea by its message in the mod queue,
+	// returns errNotFound for messages queued before ideas were stored
+	getByQueueMessage(guildID string, messageID string) (*idea, error)
+	// getByPostedMessage finds the idea by its post in the ideas channel
+	getByPostedMessage(guildID string, messageID string) (*idea, error)
+	// listOpen returns the pending and approved ideas in the guild, oldest first
+	listOpen(guildID string) ([]*idea, error)
+	// update saves everything but the ID, guild, author and creation time
+	update(i *idea) error
+	// review saves the status and review of the idea if its status is still
+	// from, returns errNotFound if it isn't, eg. when someone else reviewed it
+	review(i *idea, from ideaStatus) error
+	// edit saves the content, files, similar ideas and status of the idea if
+	// it's still pending, returns errNotFound if it was reviewed in the meantime
+	edit(i *idea) error
+}
+
+const ideaColumns = `id, guild_id, author_id, content, status, created_at, updated_at, reviewer_id, reviewed_at,
+	review_reason, queue_channel_id, queue_message_id, posted_channel_id, posted_message_id, similar_ids, attachment_urls`
+
+type sqlIdeaStore struct {
+	insert               *sql.Stmt
+	query                *sql.Stmt
+	queryByQueueMessage  *sql.Stmt
+	queryByPostedMessage *sql.Stmt
+	queryOpen            *sql.Stmt
+	save                 *sql.Stmt
+	saveReview           *sql.Stmt
+	saveEdit             *sql.Stmt
+}
+
+func newSQLIdeaStore(db *storage) *sqlIdeaStore {
+	return &sqlIdeaStore{
+		// RETURNING works on both Postgres and SQLite, LastInsertId only on SQLite
+		insert: dbPrepare(db, `INSERT INTO ideas (guild_id, author_id, content, status, created_at, updated_at, similar_ids, attachment_urls)
+			VALUES ($1, $2, $3, $4, $5, $5, $6, $7) RETURNING id`),
+		query:                dbPrepare(db, "SELECT "+ideaColumns+" FROM ideas WHERE guild_id = $1 AND id = $2"),
+		queryByQueueMessage:  dbPrepare(db, "SELECT "+ideaColumns+" FROM ideas WHERE guild_id = $1 AND queue_message_id = $2"),
+		queryByPostedMessage: dbPrepare(db, "SELECT "+ideaColumns+" FROM ideas WHERE guild_id = $1 AND posted_message_id = $2"),
+		queryOpen:            dbPrepare(db, "SELECT "+ideaColumns+" FROM ideas WHERE guild_id = $1 AND status IN ($2, $3) ORDER BY id"),
+		save: dbPrepare(db, `UPDATE ideas SET content = $2, status = $3, updated_at = $4, reviewer_id = $5, reviewed_at = $6,
+			review_reason = $7, queue_channel_id = $8, queue_message_id = $9, posted_channel_id = $10, posted_message_id = $11,
+			similar_ids = $12, attachment_urls = $13 WHERE id = $1`),
+		saveReview: dbPrepare(db, `UPDATE ideas SET status = $3, updated_at = $4, reviewer_id = $5, reviewed_at = $6, review_reason = $7
+			WHERE id = $1 AND status = $2`),
+		saveEdit: dbPrepare(db, `UPDATE ideas SET content = $3, status = $4, updated_at = $5, similar_ids = $6, attachment_urls = $7
+			WHERE id = $1 AND status = $2`),
+	}
+}
+
+func (s *sqlIdeaStore) add(i *idea) error {
+	i.status = ideaPending
+	i.createdAt = time.Now().UTC()
+	i.updatedAt = i.createdAt
+	return s.insert.QueryRow(i.guildID, i.authorID, i.content, i.status, i.createdAt, joinIDs(i.similarIDs),
+		strings.Join(i.attachmentURLs, "\n")).Scan(&i.id)
+}
+
+func (s *sqlIdeaStore) get(guildID string, id int) (*idea, error) {
+	return scanIdea(s.query.QueryRow(guildID, id))
+}
+
+func (s *sqlIdeaStore) getByQueueMessage(guildID string, messageID string) (*idea, error) {
+	if len(messageID) <= 0 {
+		return nil, errNotFound
+	}
+	return scanIdea(s.queryByQueueMessage.QueryRow(guildID, messageID))
+}
+
+func (s *sqlIdeaStore) getByPostedMessage(guildID string, messageID string) (*idea, error) {
+	if len(messageID) <= 0 {
+		return nil, errNotFound
+	}
+	return scanIdea(s.queryByPostedMessage.QueryRow(guildID, messageID))
+}
+
+func (s *sqlIdeaStore) listOpen(guildID string) ([]*idea, error) {
+	rows, err := s.queryOpen.Query(guildID, ideaPending, ideaApproved)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]*idea, 0)
+	for rows.Next() {
+		i, err := scanIdea(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, i)
+	}
+	return result, rows.Err()
+}
+
+// scanIdea reads the ideaColumns from a *sql.Row or *sql.Rows.
+func scanIdea(row interface{ Scan(...interface{}) error }) (*idea, error) {
+	i := &idea{}
+	var reviewedAt sql.NullTime
+	var similarIDs, attachmentURLs string
+	err := row.Scan(&i.id, &i.guildID, &i.authorID, &i.content, &i.status, &i.createdAt, &i.updatedAt,
+		&i.reviewerID, &reviewedAt, &i.reviewReason, &i.queueChannelID, &i.queueMessageID, &i.postedChannelID, &i.postedMessageID,
+		&similarIDs, &attachmentURLs)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	i.reviewedAt = reviewedAt.Time
+	i.similarIDs = splitIDs(similarIDs)
+	if len(attachmentURLs) > 0 {
+		i.attachmentURLs = strings.Split(attachmentURLs, "\n")
+	}
+	return i, nil
+}
+
+// joinIDs stores a list of IDs in a text column, like 4,8,15.
+func joinIDs(ids []int) string {
+	parts := make([]string, 0, len(ids))
+	for _, id := range ids {
+		parts = append(parts, strconv.Itoa(id))
+	}
+	return strings.Join(parts, ",")
+}
+
+func splitIDs(value string) []int {
+	result := make([]int, 0)
+	for _, part := range strings.Split(value, ",") {
+		if id, err := strconv.Atoi(part); err == nil {
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+func (s *sqlIdeaStore) update(i *idea) error {
+	i.updatedAt = time.Now().UTC()
+	reviewedAt := sql.NullTime{Time: i.reviewedAt, Valid: !i.reviewedAt.IsZero()}
+	result, err := s.save.Exec(i.id, i.content, i.status, i.updatedAt, i.reviewerID, reviewedAt,
+		i.reviewReason, i.queueChannelID, i.queueMessageID, i.postedChannelID, i.postedMessageID, joinIDs(i.similarIDs),
+		strings.Join(i.attachmentURLs, "\n"))
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n <= 0 {
+		return errNotFound
+	}
+	return nil
+}
+
+func (s *sqlIdeaStore) review(i *idea, from ideaStatus) error {
+	i.updatedAt = time.Now().UTC()
+	reviewedAt := sql.NullTime{Time: i.reviewedAt, Valid: !i.reviewedAt.IsZero()}
+	result, err := s.saveReview.Exec(i.id, from, i.status, i.updatedAt, i.reviewerID, reviewedAt, i.reviewReason)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n <= 0 {
+		return errNotFound
+	}
+	return nil
+}
+
+func (s *sqlIdeaStore) edit(i *idea) error {
+	i.updatedAt = time.Now().UTC()
+	result, err := s.saveEdit.Exec(i.id, ideaPending, i.content, i.status, i.updatedAt, joinIDs(i.similarIDs),
+		strings.Join(i.attachmentURLs, "\n"))
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n <= 0 {
+		return errNotFound
+	}
+	return nil
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestIdeaStore(t *testing.T) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, s ideaStore)
+	}{
+		{"add and get", func(t *testing.T, s ideaStore) {
+			i := &idea{guildID: "1", authorID: "2", content: "more math", attachmentURLs: []string{"a.png", "b.png"}, similarIDs: []int{4, 8}}
+			if err := s.add(i); err != nil {
+				t.Fatal(err)
+			}
+			if i.id <= 0 || i.status != ideaPending {
+				t.Fatalf("added idea has ID %d and status %s", i.id, i.status)
+			}
+
+			got, err := s.get("1", i.id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.content != i.content || got.authorID != "2" || got.status != ideaPending {
+				t.Errorf("got %+v", got)
+			}
+			if !reflect.DeepEqual(got.attachmentURLs, i.attachmentURLs) || !reflect.DeepEqual(got.similarIDs, i.similarIDs) {
+				t.Errorf("got attachments %v and similar ideas %v", got.attachmentURLs, got.similarIDs)
+			}
+
+			if _, err := s.get("3", i.id); err != errNotFound {
+				t.Errorf("got idea from another guild, err %v", err)
+			}
+			if _, err := s.get("1", i.id+1); err != errNotFound {
+				t.Errorf("got missing idea, err %v", err)
+			}
+		}},
+		{"update and find by message", func(t *testing.T, s ideaStore) {
+			i := &idea{guildID: "1", authorID: "2", content: "more math"}
+			if err := s.add(i); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.getByQueueMessage("1", ""); err != errNotFound {
+				t.Errorf("found idea without queue message, err %v", err)
+			}
+
+			i.status = ideaApproved
+			i.reviewerID = "5"
+			i.reviewedAt = time.Now().UTC()
+			i.queueChannelID, i.queueMessageID = "10", "11"
+			i.postedChannelID, i.postedMessageID = "20", "21"
+			if err := s.update(i); err != nil {
+				t.Fatal(err)
+			}
+
+			finds := []struct {
+				find      func(string, string) (*idea, error)
+				messageID string
+			}{{s.getByQueueMessage, "11"}, {s.getByPostedMessage, "21"}}
+			for _, f := range finds {
+				got, err := f.find("1", f.messageID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got.id != i.id || got.status != ideaApproved || got.reviewerID != "5" || got.reviewedAt.IsZero() {
+					t.Errorf("got %+v", got)
+				}
+			}
+			if _, err := s.getByPostedMessage("3", "21"); err != errNotFound {
+				t.Errorf("found idea from another guild, err %v", err)
+			}
+
+			if err := s.update(&idea{id: i.id + 1}); err != errNotFound {
+				t.Errorf("updating a missing idea returned %v", err)
+			}
+		}},
+		{"review", func(t *testing.T, s ideaStore) {
+			i := &idea{guildID: "1", authorID: "2", content: "more math"}
+			if err := s.add(i); err != nil {
+				t.Fatal(err)
+			}
+
+			first, second := *i, *i
+			first.status, first.reviewerID, first.reviewedAt = ideaApproved, "5", time.Now().UTC()
+			second.status, second.reviewerID, second.reviewedAt = ideaRejected, "6", time.Now().UTC()
+			if err := s.review(&first, ideaPending); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.review(&second, ideaPending); err != errNotFound {
+				t.Errorf("second review of a pending idea returned %v", err)
+			}
+
+			got, _ := s.get("1", i.id)
+			if got.status != ideaApproved || got.reviewerID != "5" || got.content != "more math" {
+				t.Errorf("got %+v", got)
+			}
+
+			// Undoing the review
+			first.status, first.reviewerID, first.reviewedAt = ideaPending, "", time.Time{}
+			if err := s.review(&first, ideaApproved); err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := s.get("1", i.id); got.status != ideaPending || !got.reviewedAt.IsZero() {
+				t.Errorf("got %+v", got)
+			}
+		}},
+		{"edit", func(t *testing.T, s ideaStore) {
+			i := &idea{guildID: "1", authorID: "2", content: "more math"}
+			if err := s.add(i); err != nil {
+				t.Fatal(err)
+			}
+
+			edited := *i
+			edited.content, edited.attachmentURLs, edited.similarIDs = "even more math", []string{"a.png"}, []int{4}
+			if err := s.edit(&edited); err != nil {
+				t.Fatal(err)
+			}
+			got, _ := s.get("1", i.id)
+			if got.content != "even more math" || !reflect.DeepEqual(got.attachmentURLs, edited.attachmentURLs) ||
+				!reflect.DeepEqual(got.similarIDs, edited.similarIDs) {
+				t.Errorf("got %+v", got)
+			}
+
+			// A mod approved it in the meantime
+			reviewed := *i
+			reviewed.status = ideaApproved
+			if err := s.review(&reviewed, ideaPending); err != nil {
+				t.Fatal(err)
+			}
+			edited.status = ideaWithdrawn
+			if err := s.edit(&edited); err != errNotFound {
+				t.Errorf("editing a reviewed idea returned %v", err)
+			}
+			if got, _ := s.get("1", i.id); got.status != ideaApproved {
+				t.Errorf("got %+v", got)
+			}
+		}},
+		{"list open", func(t *testing.T, s ideaStore) {
+			statuses := []ideaStatus{ideaApproved, ideaRejected, ideaPending, ideaImplemented, ideaWithdrawn}
+			for _, status := range statuses {
+				i := &idea{guildID: "1", content: string(status)}
+				if err := s.add(i); err != nil {
+					t.Fatal(err)
+				}
+				i.status = status
+				if err := s.update(i); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := s.add(&idea{guildID: "3"}); err != nil {
+				t.Fatal(err)
+			}
+
+			open, err := s.listOpen("1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(open) != 2 || open[0].status != ideaApproved || open[1].status != ideaPending {
+				t.Errorf("got %d open ideas: %+v", len(open), open)
+			}
+		}},
+	}
+
+	for _, tt := range tests {
+		stores := map[string]ideaStore{
+			"sql":    newSQLIdeaStore(newTestStorage(t)),
+			"memory": newMemoryIdeaStore(),
+		}
+		for name, s := range stores {
+			t.Run(tt.name+"/"+name, func(t *testing.T) { tt.test(t, s) })
+		}
+	}
+}
+
+type memoryIdeaStore struct {
+	mutex sync.Mutex
+	ideas []idea
+}
+
+func newMemoryIdeaStore() *memoryIdeaStore {
+	return &memoryIdeaStore{}
+}
+
+func (s *memoryIdeaStore) add(i *idea) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	i.id = len(s.ideas) + 1
+	i.status = ideaPending
+	i.createdAt = time.Now().UTC()
+	i.updatedAt = i.createdAt
+	s.ideas = append(s.ideas, *i)
+	return nil
+}
+
+func (s *memoryIdeaStore) get(guildID string, id int) (*idea, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if id <= 0 || id > len(s.ideas) || s.ideas[id-1].guildID != guildID {
+		return nil, errNotFound
+	}
+	i := s.ideas[id-1]
+	return &i, nil
+}
+
+func (s *memoryIdeaStore) getByQueueMessage(guildID string, messageID string) (*idea, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, i := range s.ideas {
+		if len(messageID) > 0 && i.guildID == guildID && i.queueMessageID == messageID {
+			return &i, nil
+		}
+	}
+	return nil, errNotFound
+}
+
+func (s *memoryIdeaStore) getByPostedMessage(guildID string, messageID string) (*idea, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, i := range s.ideas {
+		if len(messageID) > 0 && i.guildID == guildID && i.postedMessageID == messageID {
+			return &i, nil
+		}
+	}
+	return nil, errNotFound
+}
+
+func (s *memoryIdeaStore) listOpen(guildID string) ([]*idea, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	result := make([]*idea, 0)
+	for _, i := range s.ideas {
+		if i.guildID == guildID && (i.status == ideaPending || i.status == ideaApproved) {
+			found := i
+			result = append(result, &found)
+		}
+	}
+	return result, nil
+}
+
+func (s *memoryIdeaStore) update(i *idea) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if i.id <= 0 || i.id > len(s.ideas) {
+		return errNotFound
+	}
+
+	stored := &s.ideas[i.id-1]
+	i.updatedAt = time.Now().UTC()
+	stored.content = i.content
+	stored.attachmentURLs = i.attachmentURLs
+	stored.status = i.status
+	stored.updatedAt = i.updatedAt
+	stored.reviewerID = i.reviewerID
+	stored.reviewedAt = i.reviewedAt
+	stored.reviewReason = i.reviewReason
+	stored.queueChannelID = i.queueChannelID
+	stored.queueMessageID = i.queueMessageID
+	stored.postedChannelID = i.postedChannelID
+	stored.postedMessageID = i.postedMessageID
+	stored.similarIDs = i.similarIDs
+	return nil
+}
+
+func (s *memoryIdeaStore) review(i *idea, from ideaStatus) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if i.id <= 0 || i.id > len(s.ideas) || s.ideas[i.id-1].status != from {
+		return errNotFound
+	}
+
+	stored := &s.ideas[i.id-1]
+	i.updatedAt = time.Now().UTC()
+	stored.status = i.status
+	stored.updatedAt = i.updatedAt
+	stored.reviewerID = i.reviewerID
+	stored.reviewedAt = i.reviewedAt
+	stored.reviewReason = i.reviewReason
+	return nil
+}
+
+func (s *memoryIdeaStore) edit(i *idea) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if i.id <= 0 || i.id > len(s.ideas) || s.ideas[i.id-1].status != ideaPending {
+		return errNotFound
+	}
+
+	stored := &s.ideas[i.id-1]
+	i.updatedAt = time.Now().UTC()
+	stored.content = i.content
+	stored.attachmentURLs = i.attachmentURLs
+	stored.status = i.status
+	stored.updatedAt = i.updatedAt
+	stored.similarIDs = i.similarIDs
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+)
+
+// ideaScore adds up the votes on an idea, up and down are how many of each
+// it got.
+type ideaScore struct {
+	ideaID int
+	score  int
+	up     int
+	down   int
+}
+
+// ideaVoteStore keeps the votes on posted ideas, one per user and idea, with
+// when they were cast so recent votes can be told apart.
+type ideaVoteStore interface {
+	// vote sets the user's vote on the idea to 1 or -1, replacing an earlier one
+	vote(guildID string, ideaID int, userID string, value int) error
+	// unvote removes the user's vote if it is value, so taking back a vote
+	// that was already replaced does nothing
+	unvote(ideaID int, userID string, value int) error
+	// score is all the votes on the idea, zero if it has none
+	score(ideaID int) (ideaScore, error)
+	// top returns the ideas in the guild with the highest positive scores,
+	// only counting votes cast since then
+	top(guildID string, since time.Time, limit int) ([]ideaScore, error)
+}
+
+const ideaScoreColumns = `SUM(value), SUM(CASE WHEN value > 0 THEN 1 ELSE 0 END), SUM(CASE WHEN value < 0 THEN 1 ELSE 0 END)`
+
+type sqlIdeaVoteStore struct {
+	upsert     *sql.Stmt
+	delete     *sql.Stmt
+	queryScore *sql.Stmt
+	queryTop   *sql.Stmt
+}
+
+func newSQLIdeaVoteStore(db *storage) *sqlIdeaVoteStore {
+	return &sqlIdeaVoteStore{
+		upsert: dbPrepare(db, `INSERT INTO idea_votes (guild_id, idea_id, user_id, value, voted_at) VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (idea_id, user_id) DO UPDATE SET value = excluded.value, voted_at = excluded.voted_at`),
+		delete:     dbPrepare(db, "DELETE FROM idea_votes WHERE idea_id = $1 AND user_id = $2 AND value = $3"),
+		queryScore: dbPrepare(db, "SELECT "+ideaScoreColumns+" FROM idea_votes WHERE idea_id = $1 GROUP BY idea_id"),
+		queryTop: dbPrepare(db, "SELECT idea_id, "+ideaScoreColumns+` FROM idea_votes WHERE guild_id = $1 AND voted_at >= $2
+			GROUP BY idea_id HAVING SUM(value) > 0 ORDER BY SUM(value) DESC, idea_id LIMIT $3`),
+	}
+}
+
+func (s *sqlIdeaVoteStore) vote(guildID string, ideaID int, userID string, value int) error {
+	_, err := s.upsert.Exec(guildID, ideaID, userID, value, time.Now().UTC())
+	return err
+}
+
+func (s *sqlIdeaVoteStore) unvote(ideaID int, userID string, value int) error {
+	_, err := s.delete.Exec(ideaID, userID, value)
+	return err
+}
+
+func (s *sqlIdeaVoteStore) score(ideaID int) (ideaScore, error) {
+	result := ideaScore{ideaID: ideaID}
+	err := s.queryScore.QueryRow(ideaID).Scan(&result.score, &result.up, &result.down)
+	if err == sql.ErrNoRows {
+		return result, nil
+	}
+	return result, err
+}
+
+func (s *sqlIdeaVoteStore) top(guildID string, since time.Time, limit int) ([]ideaScore, error) {
+	rows, err := s.queryTop.Query(guildID, since.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]ideaScore, 0)
+	for rows.Next() {
+		var sc ideaScore
+		if err := rows.Scan(&sc.ideaID, &sc.score, &sc.up, &sc.down); err != nil {
+			return nil, err
+		}
+		result = append(result, sc)
+	}
+	return result, rows.Err()
+}
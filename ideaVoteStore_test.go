@@ -0,0 +1,191 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestIdeaVoteStore(t *testing.T) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, s ideaVoteStore)
+	}{
+		{"vote replaces earlier votes", func(t *testing.T, s ideaVoteStore) {
+			if sc, err := s.score(1); err != nil || sc != (ideaScore{ideaID: 1}) {
+				t.Fatalf("score without votes is %+v, err %v", sc, err)
+			}
+
+			for _, v := range []struct {
+				userID string
+				value  int
+			}{{"a", 1}, {"b", 1}, {"c", -1}, {"a", -1}} {
+				if err := s.vote("1", 1, v.userID, v.value); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			sc, err := s.score(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := (ideaScore{ideaID: 1, score: -1, up: 1, down: 2}); sc != want {
+				t.Errorf("score is %+v, want %+v", sc, want)
+			}
+		}},
+		{"unvote only removes the same vote", func(t *testing.T, s ideaVoteStore) {
+			if err := s.vote("1", 1, "a", -1); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.unvote(1, "a", 1); err != nil {
+				t.Fatal(err)
+			}
+			if sc, _ := s.score(1); sc.score != -1 {
+				t.Errorf("unvoting an up vote removed the down vote, score is %d", sc.score)
+			}
+
+			if err := s.unvote(1, "a", -1); err != nil {
+				t.Fatal(err)
+			}
+			if sc, _ := s.score(1); sc.score != 0 || sc.down != 0 {
+				t.Errorf("vote wasn't removed, score is %+v", sc)
+			}
+		}},
+		{"top", func(t *testing.T, s ideaVoteStore) {
+			votes := []struct {
+				guildID string
+				ideaID  int
+				userID  string
+				value   int
+			}{
+				{"1", 1, "a", 1},
+				{"1", 2, "a", 1}, {"1", 2, "b", 1},
+				{"1", 3, "a", -1},
+				{"1", 4, "a", 1}, {"1", 4, "b", 1},
+				{"2", 5, "a", 1}, {"2", 5, "b", 1}, {"2", 5, "c", 1},
+			}
+			for _, v := range votes {
+				if err := s.vote(v.guildID, v.ideaID, v.userID, v.value); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			top, err := s.top("1", time.Now().Add(-time.Hour), 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(top) != 2 || top[0].ideaID != 2 || top[1].ideaID != 4 || top[0].up != 2 {
+				t.Errorf("top is %+v", top)
+			}
+
+			if top, _ := s.top("1", time.Now().Add(time.Hour), 2); len(top) != 0 {
+				t.Errorf("votes cast before since were counted: %+v", top)
+			}
+		}},
+	}
+
+	for _, tt := range tests {
+		stores := map[string]ideaVoteStore{
+			"sql":    newSQLIdeaVoteStore(newTestStorage(t)),
+			"memory": newMemoryIdeaVoteStore(),
+		}
+		for name, s := range stores {
+			t.Run(tt.name+"/"+name, func(t *testing.T) { tt.test(t, s) })
+		}
+	}
+}
+
+type ideaVoteKey struct {
+	ideaID int
+	userID string
+}
+
+type ideaVote struct {
+	guildID string
+	value   int
+	votedAt time.Time
+}
+
+type memoryIdeaVoteStore struct {
+	mutex sync.Mutex
+	votes map[ideaVoteKey]ideaVote
+}
+
+func newMemoryIdeaVoteStore() *memoryIdeaVoteStore {
+	return &memoryIdeaVoteStore{votes: make(map[ideaVoteKey]ideaVote)}
+}
+
+func (s *memoryIdeaVoteStore) vote(guildID string, ideaID int, userID string, value int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.votes[ideaVoteKey{ideaID, userID}] = ideaVote{guildID, value, time.Now().UTC()}
+	return nil
+}
+
+func (s *memoryIdeaVoteStore) unvote(ideaID int, userID string, value int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	key := ideaVoteKey{ideaID, userID}
+	if v, ok := s.votes[key]; ok && v.value == value {
+		delete(s.votes, key)
+	}
+	return nil
+}
+
+func (s *memoryIdeaVoteStore) score(ideaID int) (ideaScore, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	result := ideaScore{ideaID: ideaID}
+	for key, v := range s.votes {
+		if key.ideaID == ideaID {
+			result.add(v.value)
+		}
+	}
+	return result, nil
+}
+
+func (s *memoryIdeaVoteStore) top(guildID string, since time.Time, limit int) ([]ideaScore, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	scores := make(map[int]*ideaScore)
+	for key, v := range s.votes {
+		if v.guildID != guildID || v.votedAt.Before(since) {
+			continue
+		}
+		if _, ok := scores[key.ideaID]; !ok {
+			scores[key.ideaID] = &ideaScore{ideaID: key.ideaID}
+		}
+		scores[key.ideaID].add(v.value)
+	}
+
+	result := make([]ideaScore, 0, len(scores))
+	for _, sc := range scores {
+		if sc.score > 0 {
+			result = append(result, *sc)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].score != result[j].score {
+			return result[i].score > result[j].score
+		}
+		return result[i].ideaID < result[j].ideaID
+	})
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+func (sc *ideaScore) add(value int) {
+	sc.score += value
+	if value > 0 {
+		sc.up++
+	} else {
+		sc.down++
+	}
+}
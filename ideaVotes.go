@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	ideaUpvoteEmoji   = "👍"
+	ideaDownvoteEmoji = "👎"
+
+	// ideaTrendingPeriod is how far back the weekly summary counts votes
+	ideaTrendingPeriod = 7 * 24 * time.Hour
+	ideaTopDefault     = 10
+	ideaTopLimit       = 25
+)
+
+// addIdeaVoteReactions starts off the votes on a posted idea, so people only
+// have to click.
+func addIdeaVoteReactions(s discordSession, channelID string, messageID string) {
+	for _, emoji := range []string{ideaUpvoteEmoji, ideaDownvoteEmoji} {
+		if err := s.MessageReactionAdd(channelID, messageID, emoji); err != nil {
+			log.Printf("Couldn't add %s to idea message %s: %s", emoji, messageID, err)
+		}
+	}
+}
+
+func ideaVoteReactionAdd(s discordSession, r *discordgo.MessageReactionAdd) {
+	ideaVoteReaction(s, r.MessageReaction, true)
+}
+
+func ideaVoteReactionRemove(s discordSession, r *discordgo.MessageReactionRemove) {
+	ideaVoteReaction(s, r.MessageReaction, false)
+}
+
+// ideaVoteReaction counts vote reactions on ideas posted in the ideas channel.
+func ideaVoteReaction(s discordSession, r *discordgo.MessageReaction, added bool) {
+	if r.UserID == s.state().User.ID || moduleEnabledByName(r.GuildID, ideasModuleName) == false {
+		return
+	}
+	if r.ChannelID != guildConfigGet(r.GuildID, configIdeasChannel) {
+		return
+	}
+
+	var value int
+	switch r.Emoji.Name {
+	case ideaUpvoteEmoji:
+		value = 1
+	case ideaDownvoteEmoji:
+		value = -1
+	default:
+		return
+	}
+
+	i, err := ideas.getByPostedMessage(r.GuildID, r.MessageID)
+	if err == errNotFound {
+		return
+	}
+	if err != nil {
+		log.Printf("Error trying to load the idea of message %s: %s", r.MessageID, err)
+		return
+	}
+
+	if added {
+		err = ideaVotes.vote(i.guildID, i.id, r.UserID, value)
+	} else {
+		err = ideaVotes.unvote(i.id, r.UserID, value)
+	}
+	if err != nil {
+		log.Printf("Error trying to save vote of %s on idea #%d: %s", r.UserID, i.id, err)
+	}
+}
+
+func ideaTopHandler(ctx *commandContext) {
+	count := ideaTopDefault
+	if ctx.args.has("count") {
+		count = ctx.args.integer("count")
+	}
+	if count <= 0 || count > ideaTopLimit {
+		ctx.reply(fmt.Sprintf("`count` has to be between 1 and %d", ideaTopLimit))
+		return
+	}
+
+	scores, err := ideaVotes.top(ctx.guildID, time.Time{}, count)
+	if err != nil {
+		log.Printf("Error trying to load the top ideas of %s: %s", ctx.guildID, err)
+		ctx.reply("Couldn't load the top ideas, try again later")
+		return
+	}
+	if len(scores) <= 0 {
+		ctx.reply("No ideas have been voted up yet")
+		return
+	}
+
+	ctx.replyMessage(&discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{{
+		Title:       "Top ideas",
+		Description: describeIdeaScores(ctx.guildID, scores),
+		Color:       helpEmbedColor,
+	}}})
+}
+
+func postTrendingIdeas() {
+	for _, guildID := range connectedGuildIDs(botSession) {
+		if moduleEnabledByName(guildID, ideasModuleName) {
+			postGuildTrendingIdeas(botSession, guildID)
+		}
+	}
+}
+
+// postGuildTrendingIdeas posts the ideas that got the most votes in the last
+// week to the ideas channel, if any did.
+func postGuildTrendingIdeas(s discordSession, guildID string) {
+	ideasChannelID := guildConfigGet(guildID, configIdeasChannel)
+	if len(ideasChannelID) <= 0 {
+		return
+	}
+
+	scores, err := ideaVotes.top(guildID, time.Now().Add(-ideaTrendingPeriod), 5)
+	if err != nil {
+		log.Printf("Error trying to load the trending ideas of %s: %s", guildID, err)
+		return
+	}
+	if len(scores) <= 0 {
+		return
+	}
+
+	_, err = s.ChannelMessageSendComplex(ideasChannelID, &discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{{
+		Title:       "Trending ideas this week",
+		Description: describeIdeaScores(guildID, scores),
+		Color:       helpEmbedColor,
+		Footer:      &discordgo.MessageEmbedFooter{Text: fmt.Sprintf("Vote with %s and %s on the ideas you like", ideaUpvoteEmoji, ideaDownvoteEmoji)},
+	}}})
+	if err != nil {
+		log.Printf("Couldn't post the trending ideas of %s: %s", guildID, err)
+	}
+}
+
+// describeIdeaScores lists the ideas with their scores and a link to vote.
+func describeIdeaScores(guildID string, scores []ideaScore) string {
+	var sb strings.Builder
+	for n, sc := range scores {
+		i, err := ideas.get(guildID, sc.ideaID)
+		if err != nil {
+			log.Printf("Error trying to load idea #%d: %s", sc.ideaID, err)
+			continue
+		}
+
+		title := fmt.Sprintf("#%d", i.id)
+		if len(i.postedMessageID) > 0 {
+			title = fmt.Sprintf("[#%d](https://discord.com/channels/%s/%s/%s)", i.id, i.guildID, i.postedChannelID, i.postedMessageID)
+		}
+		sb.WriteString(fmt.Sprintf("**%d.** %s %s\n%s\n", n+1, title, describeIdeaScore(sc), truncate(i.content, 100)))
+	}
+	return sb.String()
+}
+
+func describeIdeaScore(sc ideaScore) string {
+	return fmt.Sprintf("**%+d** (%s %d %s %d)", sc.score, ideaUpvoteEmoji, sc.up, ideaDownvoteEmoji, sc.down)
+}
@@ -4,18 +4,49 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
-	"os"
 	"strings"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
+	"github.com/go-co-op/gocron"
 )
 
+const ideasModuleName = "ideas"
+
 var (
-	modQueueChannel *discordgo.Channel
-	ideasChannel *discordgo.Channel
+	ideasModule = &module{
+		name:           ideasModuleName,
+		description:    "Let users suggest ideas that mods review before they're posted",
+		defaultEnabled: true,
+		setup:          setupIdeasModule,
+	}
+
+	addIdeaArgs = []commandArg{
+		{name: "idea", description: "The idea you want to suggest", kind: argText, required: true},
+		{name: "file", description: "A picture or mockup to go with the idea", kind: argAttachment},
+	}
+	editIdeaArgs = []commandArg{
+		ideaIDArg,
+		{name: "idea", description: "The new text of the idea", kind: argText, required: true},
+		{name: "file", description: "Replaces the files uploaded with the idea", kind: argAttachment},
+	}
+	ideaIDArg      = commandArg{name: "id", description: "The number the idea got when it was suggested", kind: argInt, required: true}
+	ideaReviewArgs = []commandArg{
+		ideaIDArg,
+		{name: "reason", description: "Why, this is sent to the author", kind: argText},
+	}
 )
 
+const (
+	ideaApprovedColor  = 0x57F287
+	ideaRejectedColor  = 0xED4245
+	ideaWithdrawnColor = 0x99AAB5
+)
+
+// modQueueItem is how ideas were put in the mod queue before they were stored,
+// as JSON in the message. Only read to handle reactions on those messages.
 type modQueueItem struct {
+	IdeaID           int    `json:"ideaID"`
 	AuthorID         string `json:"authorID"`
 	AuthorName       string `json:"authorName"`
 	GuildID          string `json:"guildID"`
@@ -24,83 +55,562 @@ type modQueueItem struct {
 	Content          string `json:"content"`
 }
 
-func initIdeasChannel(s *discordgo.Session) {
-	channelId := os.Getenv("VPBOT_MOD_QUEUE_CHANNEL")
-	ideasChannelId := os.Getenv("VPBOT_IDEAS_CHANNEL")
+func setupIdeasModule(m *module, db *storage, scheduler *gocron.Scheduler) {
+	ideas = newSQLIdeaStore(db)
+	ideaVotes = newSQLIdeaVoteStore(db)
+
+	ideaGroup := m.addCommand(&commandHandler{
+		commandString: "idea",
+		description:   "Suggest ideas for the server",
+		category:      "Ideas",
+		ephemeral:     true,
+	})
+	ideaAdd := addSubcommand(ideaGroup, &commandHandler{
+		commandString: "add",
+		description:   "Suggest an idea to add to the server's idea channel, will go into a manual review queue before being posted",
+		aliases:       []string{"suggest"},
+		cooldown:      commandCooldown{user: 5 * time.Minute},
+		args:          addIdeaArgs,
+		handleFunc:    addIdeasHandler,
+	})
+	// Kept so people used to the old name aren't left hanging
+	addCommandAlias("addidea", ideaAdd)
+	addSubcommand(ideaGroup, &commandHandler{
+		commandString: "status",
+		description:   "See how far along one of your ideas is",
+		guildOnly:     true,
+		args:          []commandArg{ideaIDArg},
+		handleFunc:    ideaStatusHandler,
+	})
+	addSubcommand(ideaGroup, &commandHandler{
+		commandString: "edit",
+		description:   "Change one of your ideas while it's waiting for review",
+		guildOnly:     true,
+		args:          editIdeaArgs,
+		handleFunc:    ideaEditHandler,
+	})
+	addSubcommand(ideaGroup, &commandHandler{
+		commandString: "withdraw",
+		description:   "Take back one of your ideas while it's waiting for review",
+		aliases:       []string{"cancel"},
+		guildOnly:     true,
+		args:          []commandArg{ideaIDArg},
+		handleFunc:    ideaWithdrawHandler,
+	})
+	addSubcommand(ideaGroup, &commandHandler{
+		commandString: "implemented",
+		description:   "Mark an approved idea as implemented",
+		aliases:       []string{"done"},
+		modOnly:       true,
+		guildOnly:     true,
+		args:          []commandArg{ideaIDArg},
+		handleFunc:    ideaImplementedHandler,
+	})
+	addSubcommand(ideaGroup, &commandHandler{
+		commandString: "top",
+		description:   "List the ideas with the most votes",
+		guildOnly:     true,
+		args: []commandArg{
+			{name: "count", description: fmt.Sprintf("How many ideas to list, %d by default", ideaTopDefault), kind: argInt},
+		},
+		handleFunc: ideaTopHandler,
+	})
+	ideaApproveCommand = addSubcommand(ideaGroup, &commandHandler{
+		commandString: "approve",
+		description:   "Approve a suggested idea and post it in the ideas channel",
+		modOnly:       true,
+		guildOnly:     true,
+		args:          ideaReviewArgs,
+		handleFunc:    ideaApproveHandler,
+	})
+	ideaRejectCommand = addSubcommand(ideaGroup, &commandHandler{
+		commandString: "reject",
+		description:   "Reject a suggested idea, the author gets a DM with the reason",
+		modOnly:       true,
+		guildOnly:     true,
+		args:          ideaReviewArgs,
+		handleFunc:    ideaRejectHandler,
+	})
 
-	if(len(channelId) <= 0) {
+	addComponentHandler(ideaQueueComponentPrefix, ideaQueueButtonHandler)
+	addModalHandler(ideaQueueComponentPrefix, ideaQueueModalHandler)
+	m.addEventHandler(ideasQueueReactionAdd)
+	m.addEventHandler(ideaVoteReactionAdd)
+	m.addEventHandler(ideaVoteReactionRemove)
+
+	_, err := scheduler.Every(1).Monday().At("15:00").Do(postTrendingIdeas)
+	if err != nil {
+		log.Panic(err)
+	}
+}
+
+func addIdeasHandler(ctx *commandContext) {
+	modQueueChannelID := guildConfigGet(ctx.guildID, configIdeasQueueChannel)
+	ideasChannelID := guildConfigGet(ctx.guildID, configIdeasChannel)
+	if len(modQueueChannelID) <= 0 || len(ideasChannelID) <= 0 {
+		ctx.reply("Guild does not have an ideas channel, ask a mod to add one")
+		return
+	}
+
+	content := strings.TrimSpace(ctx.args.text("idea"))
+	if len(normalizeIdeaText(content)) <= 0 {
+		ctx.reply("Your idea is empty, write what you'd like to see after the command")
 		return
 	}
 
-	var err error
-	modQueueChannel, err = s.Channel(channelId)
+	similar, err := findSimilarIdeas(ctx.guildID, content)
 	if err != nil {
-		log.Printf("Couldn't find the ideas channel with ID: %s or %s", channelId, ideasChannelId)
+		log.Printf("Error trying to look for ideas like the one from %s: %s", ctx.author.String(), err)
+	}
+	for _, sim := range similar {
+		if sim.idea.status == ideaApproved && sim.similarity >= ideaDuplicateThreshold {
+			ctx.reply(fmt.Sprintf("This looks like idea #%d, vote there instead: %s", sim.idea.id, ideaLink(sim.idea)))
+			return
+		}
+	}
+
+	i := &idea{
+		guildID:        ctx.guildID,
+		authorID:       ctx.author.ID,
+		content:        content,
+		attachmentURLs: attachmentURLs(ctx.args.attachments("file")),
+		similarIDs:     similarIdeaIDs(similar, 0),
+	}
+	if err := ideas.add(i); err != nil {
+		log.Printf("Error trying to save idea from %s: %s", ctx.author.String(), err)
+		ctx.reply("Couldn't save your idea, try again later")
 		return
 	}
 
-	ideasChannel, err = s.Channel(ideasChannelId)
+	queued, err := ctx.session.ChannelMessageSendComplex(modQueueChannelID, ideaQueueMessage(i))
 	if err != nil {
-		log.Printf("Couldn't find the ideas channel with ID: %s or %s", channelId, ideasChannelId)
+		log.Printf("Error trying to send idea #%d to the mod queue: %s", i.id, err)
+		ctx.reply("Couldn't send your idea to the mods, try again later")
 		return
 	}
+
+	i.queueChannelID = queued.ChannelID
+	i.queueMessageID = queued.ID
+	if err := ideas.update(i); err != nil {
+		log.Printf("Error trying to save the queue message of idea #%d: %s", i.id, err)
+	}
+	reply := fmt.Sprintf("Your idea #%d has been sent to the mods for review! Check on it with `%sidea status %d`", i.id, ctx.prefix(), i.id)
+	if len(similar) > 0 {
+		reply += fmt.Sprintf("\nIt looks a bit like idea #%d, the mods will have a look at both", similar[0].idea.id)
+	}
+	ctx.reply(reply)
 }
 
-func addIdeasHandler(session *discordgo.Session, msg *discordgo.MessageCreate) {
-	if modQueueChannel == nil {
-		session.ChannelMessageSend(msg.ChannelID, "Guild does not have an ideas channel, ask a mod to add one")
+func ideaStatusHandler(ctx *commandContext) {
+	i, ok := findIdea(ctx)
+	if !ok {
+		return
+	}
+	if i.authorID != ctx.author.ID && !userAllowedAdminBotCommands(ctx.session, ctx.guildID, ctx.channelID, ctx.author.ID) {
+		ctx.reply("You can only check the status of your own ideas")
 		return
 	}
 
-	guild, _ := session.State.Guild(msg.GuildID)
+	fields := []*discordgo.MessageEmbedField{
+		{Name: "Status", Value: string(i.status), Inline: true},
+		{Name: "Suggested", Value: discordTimestamp(i.createdAt), Inline: true},
+	}
+	if !i.reviewedAt.IsZero() {
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:   "Reviewed",
+			Value:  fmt.Sprintf("%s by <@%s>", discordTimestamp(i.reviewedAt), i.reviewerID),
+			Inline: true,
+		})
+	}
+	if len(i.reviewReason) > 0 {
+		fields = append(fields, &discordgo.MessageEmbedField{Name: "Reason", Value: i.reviewReason})
+	}
+	if len(i.attachmentURLs) > 0 {
+		fields = append(fields, &discordgo.MessageEmbedField{Name: "Files", Value: describeIdeaAttachments(i)})
+	}
+	if len(i.postedMessageID) > 0 {
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:  "Posted",
+			Value: fmt.Sprintf("https://discord.com/channels/%s/%s/%s", i.guildID, i.postedChannelID, i.postedMessageID),
+		})
+		if sc, err := ideaVotes.score(i.id); err == nil {
+			fields = append(fields, &discordgo.MessageEmbedField{Name: "Votes", Value: describeIdeaScore(sc), Inline: true})
+		} else {
+			log.Printf("Error trying to load the votes on idea #%d: %s", i.id, err)
+		}
+	}
+
+	ctx.replyMessage(&discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{{
+		Title:       fmt.Sprintf("Idea #%d", i.id),
+		Description: i.content,
+		Fields:      fields,
+		Color:       helpEmbedColor,
+		Footer:      &discordgo.MessageEmbedFooter{Text: "Last updated"},
+		Timestamp:   i.updatedAt.Format(time.RFC3339),
+	}}})
+}
+
+func ideaEditHandler(ctx *commandContext) {
+	i, ok := findOwnPendingIdea(ctx, "edit")
+	if !ok {
+		return
+	}
 
-	idea := strings.TrimPrefix(msg.Content, "!addidea")
-	idea = strings.TrimSpace(idea)
+	content := strings.TrimSpace(ctx.args.text("idea"))
+	if len(normalizeIdeaText(content)) <= 0 {
+		ctx.reply("Your idea can't be empty, to take it back use `" + ctx.prefix() + "idea withdraw`")
+		return
+	}
+	i.content = content
+	if ctx.args.has("file") {
+		i.attachmentURLs = attachmentURLs(ctx.args.attachments("file"))
+	}
 
-	item := modQueueItem{
-		msg.Author.ID,
-		fmt.Sprintf("%s#%s", msg.Author.Username, msg.Author.Discriminator),
-		guild.ID,
-		guild.Name,
-		ideasChannel.ID,
-		idea,
+	similar, err := findSimilarIdeas(ctx.guildID, content)
+	if err != nil {
+		log.Printf("Error trying to look for ideas like #%d: %s", i.id, err)
 	}
+	i.similarIDs = similarIdeaIDs(similar, i.id)
 
-	data, _ := json.MarshalIndent(item, "", "    ")
-	session.ChannelMessageSend(modQueueChannel.ID, string(data))
+	err = ideas.edit(i)
+	if err == errNotFound {
+		ctx.reply(fmt.Sprintf("Idea #%d was reviewed in the meantime, it can't be changed anymore", i.id))
+		return
+	}
+	if err != nil {
+		log.Printf("Error trying to edit idea #%d: %s", i.id, err)
+		ctx.reply("Couldn't update your idea, try again later")
+		return
+	}
+	updateIdeaQueueMessage(ctx.session, i)
+	ctx.reply(fmt.Sprintf("Idea #%d has been updated", i.id))
 }
 
-func ideasQueueReactionAdd(s *discordgo.Session, r *discordgo.MessageReactionAdd) {
-	if r.UserID == s.State.User.ID {
+func ideaWithdrawHandler(ctx *commandContext) {
+	i, ok := findOwnPendingIdea(ctx, "withdraw")
+	if !ok {
 		return
 	}
 
-	guild, _ := s.State.Guild(r.GuildID)
-	channel, _ := s.State.Channel(r.ChannelID)
+	i.status = ideaWithdrawn
+	err := ideas.edit(i)
+	if err == errNotFound {
+		ctx.reply(fmt.Sprintf("Idea #%d was reviewed in the meantime, it can't be withdrawn anymore", i.id))
+		return
+	}
+	if err != nil {
+		log.Printf("Error trying to withdraw idea #%d: %s", i.id, err)
+		ctx.reply("Couldn't withdraw your idea, try again later")
+		return
+	}
+	updateIdeaQueueMessage(ctx.session, i)
+	ctx.reply(fmt.Sprintf("Idea #%d has been withdrawn", i.id))
+}
+
+// findOwnPendingIdea is findIdea for ideas the author can still change.
+func findOwnPendingIdea(ctx *commandContext, action string) (*idea, bool) {
+	i, ok := findIdea(ctx)
+	if !ok {
+		return nil, false
+	}
+	if i.authorID != ctx.author.ID {
+		ctx.reply(fmt.Sprintf("You can only %s your own ideas", action))
+		return nil, false
+	}
+	if i.status != ideaPending {
+		ctx.reply(fmt.Sprintf("Idea #%d is %s, only ideas waiting for review can be changed", i.id, i.status))
+		return nil, false
+	}
+	return i, true
+}
+
+func attachmentURLs(attachments []*discordgo.MessageAttachment) []string {
+	result := make([]string, 0, len(attachments))
+	for _, a := range attachments {
+		result = append(result, a.URL)
+	}
+	return result
+}
+
+func ideaImplementedHandler(ctx *commandContext) {
+	i, ok := findIdea(ctx)
+	if !ok {
+		return
+	}
+	if i.status != ideaApproved {
+		ctx.reply(fmt.Sprintf("Idea #%d is %s, only approved ideas can be marked as implemented", i.id, i.status))
+		return
+	}
+
+	i.status = ideaImplemented
+	if err := ideas.update(i); err != nil {
+		log.Printf("Error trying to mark idea #%d as implemented: %s", i.id, err)
+		ctx.reply("Couldn't update the idea, try again later")
+		return
+	}
+	updateIdeaQueueMessage(ctx.session, i)
+	auditCommand(ctx, auditIdeaImplemented, i.authorID, fmt.Sprintf("Idea #%d: %s", i.id, i.content))
+	ctx.reply(fmt.Sprintf("Idea #%d is now marked as implemented", i.id))
+}
+
+// findIdea looks up the idea given in the id argument, replying if it can't.
+func findIdea(ctx *commandContext) (*idea, bool) {
+	id := ctx.args.integer("id")
+	i, err := ideas.get(ctx.guildID, id)
+	if err == errNotFound {
+		ctx.reply(fmt.Sprintf("There is no idea #%d in this server", id))
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("Error trying to load idea #%d: %s", id, err)
+		ctx.reply("Couldn't load the idea, try again later")
+		return nil, false
+	}
+	return i, true
+}
+
+// discordTimestamp formats t so Discord shows it in the reader's time zone.
+func discordTimestamp(t time.Time) string {
+	return fmt.Sprintf("<t:%d:f>", t.Unix())
+}
+
+// ideasQueueReactionAdd lets mods review with yes and no reactions as well,
+// which is all there was before the queue had buttons.
+func ideasQueueReactionAdd(s discordSession, r *discordgo.MessageReactionAdd) {
+	if r.UserID == s.state().User.ID || moduleEnabledByName(r.GuildID, ideasModuleName) == false {
+		return
+	}
+
+	guild, _ := s.state().Guild(r.GuildID)
+	channel, _ := s.state().Channel(r.ChannelID)
 	user, _ := s.User(r.UserID)
 
 	log.Printf("[%s|%s|%s#%s] (%s) Reaction added: %+v\n", guild.Name, channel.Name, user.Username, user.Discriminator, r.MessageID, r.Emoji)
 
-	if r.ChannelID == modQueueChannel.ID {
+	if r.ChannelID != guildConfigGet(r.GuildID, configIdeasQueueChannel) || (r.Emoji.Name != "yes" && r.Emoji.Name != "no") {
+		return
+	}
+
+	cmd := ideaApproveCommand
+	if r.Emoji.Name == "no" {
+		cmd = ideaRejectCommand
+	}
+	if !commandAllowed(s, r.GuildID, r.ChannelID, r.UserID, cmd) {
+		log.Printf("User %s tried to review queue message %s but is not allowed", r.UserID, r.MessageID)
+		return
+	}
+
+	i, err := ideas.getByQueueMessage(r.GuildID, r.MessageID)
+	if err == errNotFound {
+		// Queued before ideas were stored, all there is is the message
 		if r.Emoji.Name == "yes" {
-			m, _ := s.ChannelMessage(r.ChannelID, r.MessageID)
-
-			// Already moderated?
-			for _, e := range m.Reactions {
-				if (e.Emoji.Name == "yes" || e.Emoji.Name == "no") && e.Emoji.Name != r.Emoji.Name {
-					return
-				}
-			}
-
-			var item modQueueItem
-			if err := json.Unmarshal([]byte(m.Content), &item); err != nil {
-				s.ChannelMessageSend(r.ChannelID, err.Error())
-			} else {
-				member, _ := s.GuildMember(item.GuildID, item.AuthorID)
-				message := fmt.Sprintf("%s's idea: %s", member.User.Mention(), item.Content)
-
-				s.ChannelMessageSend(item.PostingChannelID, message)
-			}
+			postLegacyQueueItem(s, r)
 		}
+		return
+	}
+	if err != nil {
+		log.Printf("Error trying to load the idea of queue message %s: %s", r.MessageID, err)
+		return
+	}
+	// Already moderated
+	if i.status != ideaPending {
+		return
+	}
+
+	if r.Emoji.Name == "yes" {
+		err = approveIdea(s, i, r.UserID, "")
+	} else {
+		err = rejectIdea(s, i, r.UserID, "")
+	}
+	if err != nil {
+		log.Printf("Error trying to review idea #%d: %s", i.id, err)
+		s.ChannelMessageSend(r.ChannelID, fmt.Sprintf("Couldn't review idea #%d: %s", i.id, err))
+	}
+}
+
+func postLegacyQueueItem(s discordSession, r *discordgo.MessageReactionAdd) {
+	m, _ := s.ChannelMessage(r.ChannelID, r.MessageID)
+
+	// Already moderated?
+	for _, e := range m.Reactions {
+		if (e.Emoji.Name == "yes" || e.Emoji.Name == "no") && e.Emoji.Name != r.Emoji.Name {
+			return
+		}
+	}
+
+	var item modQueueItem
+	if err := json.Unmarshal([]byte(m.Content), &item); err != nil {
+		s.ChannelMessageSend(r.ChannelID, err.Error())
+	} else {
+		member, _ := s.GuildMember(item.GuildID, item.AuthorID)
+		message := fmt.Sprintf("%s's idea: %s", member.User.Mention(), item.Content)
+
+		s.ChannelMessageSend(item.PostingChannelID, message)
+	}
+}
+
+func ideaApproveHandler(ctx *commandContext) {
+	reviewIdeaCommand(ctx, approveIdea)
+}
+
+func ideaRejectHandler(ctx *commandContext) {
+	reviewIdeaCommand(ctx, rejectIdea)
+}
+
+func reviewIdeaCommand(ctx *commandContext, review func(discordSession, *idea, string, string) error) {
+	i, ok := findIdea(ctx)
+	if !ok {
+		return
+	}
+	if i.status != ideaPending {
+		ctx.reply(fmt.Sprintf("Idea #%d has already been reviewed, it's %s", i.id, i.status))
+		return
+	}
+
+	if err := review(ctx.session, i, ctx.author.ID, ctx.args.text("reason")); err != nil {
+		log.Printf("Error trying to review idea #%d: %s", i.id, err)
+		ctx.reply(fmt.Sprintf("Couldn't review idea #%d: %s", i.id, err))
+		return
+	}
+	ctx.reply(fmt.Sprintf("Idea #%d is now %s, the author has been told", i.id, i.status))
+}
+
+// approveIdea records the approval and posts the idea in the ideas channel.
+func approveIdea(s discordSession, i *idea, reviewerID string, reason string) error {
+	channelID := guildConfigGet(i.guildID, configIdeasChannel)
+	if len(channelID) <= 0 {
+		return fmt.Errorf("the server doesn't have an ideas channel")
+	}
+
+	// Recorded first, so only one of two mods approving at once posts it
+	if err := recordIdeaReview(i, ideaApproved, reviewerID, reason); err != nil {
+		return err
+	}
+
+	// Discord shows the files from their links
+	message := fmt.Sprintf("<@%s>'s idea: %s", i.authorID, i.content)
+	for _, url := range i.attachmentURLs {
+		message += "\n" + url
+	}
+	posted, err := s.ChannelMessageSend(channelID, message)
+	if err != nil {
+		undoIdeaReview(i)
+		return err
+	}
+	i.postedChannelID = posted.ChannelID
+	i.postedMessageID = posted.ID
+	addIdeaVoteReactions(s, posted.ChannelID, posted.ID)
+	if err := ideas.update(i); err != nil {
+		log.Printf("Error trying to save the post of idea #%d: %s", i.id, err)
+	}
+
+	announceIdeaReview(s, i)
+	return nil
+}
+
+func rejectIdea(s discordSession, i *idea, reviewerID string, reason string) error {
+	if err := recordIdeaReview(i, ideaRejected, reviewerID, reason); err != nil {
+		return err
+	}
+
+	announceIdeaReview(s, i)
+	return nil
+}
+
+// recordIdeaReview saves the decision, unless someone else reviewed the idea
+// since it was loaded.
+func recordIdeaReview(i *idea, status ideaStatus, reviewerID string, reason string) error {
+	i.status = status
+	i.reviewerID = reviewerID
+	i.reviewedAt = time.Now().UTC()
+	i.reviewReason = reason
+
+	err := ideas.review(i, ideaPending)
+	if err == errNotFound {
+		return fmt.Errorf("someone else reviewed it first")
+	}
+	return err
+}
+
+// undoIdeaReview makes an approved idea that couldn't be posted pending
+// again, so it can be approved once posting works.
+func undoIdeaReview(i *idea) {
+	i.status = ideaPending
+	i.reviewerID = ""
+	i.reviewedAt = time.Time{}
+	i.reviewReason = ""
+	if err := ideas.review(i, ideaApproved); err != nil {
+		log.Printf("Error trying to undo the approval of idea #%d: %s", i.id, err)
+	}
+}
+
+// announceIdeaReview marks the decision on the idea's queue message, lets the
+// author know and adds it to the audit log.
+func announceIdeaReview(s discordSession, i *idea) {
+	updateIdeaQueueMessage(s, i)
+	notifyIdeaAuthor(s, i)
+
+	action := auditIdeaApproved
+	if i.status == ideaRejected {
+		action = auditIdeaRejected
+	}
+	details := fmt.Sprintf("Idea #%d: %s", i.id, i.content)
+	if len(i.reviewReason) > 0 {
+		details += "\nReason: " + i.reviewReason
+	}
+	recordAudit(s, auditEntry{guildID: i.guildID, action: action, actorID: i.reviewerID, targetID: i.authorID, details: details})
+}
+
+// announceIdeaEdit shows the new text on the idea's queue message, lets the
+// author know a mod edited their idea and adds it to the audit log.
+func announceIdeaEdit(s discordSession, i *idea, modID string) {
+	updateIdeaQueueMessage(s, i)
+
+	content := fmt.Sprintf("Your idea #%d in '%s' was edited by <@%s>, it now reads:\n> %s", i.id, ideaGuildName(s, i), modID, i.content)
+	dm, err := s.UserChannelCreate(i.authorID)
+	if err == nil {
+		_, err = s.ChannelMessageSend(dm.ID, content)
+	}
+	if err != nil {
+		log.Printf("Couldn't tell %s about the edit of idea #%d: %s", i.authorID, i.id, err)
+	}
+
+	recordAudit(s, auditEntry{guildID: i.guildID, action: auditIdeaEdited, actorID: modID, targetID: i.authorID,
+		details: fmt.Sprintf("Idea #%d: %s", i.id, i.content)})
+}
+
+// ideaGuildName is the name of the idea's server for DMs, or its ID if the
+// server isn't in the state.
+func ideaGuildName(s discordSession, i *idea) string {
+	if guild, err := s.state().Guild(i.guildID); err == nil {
+		return guild.Name
+	}
+	return i.guildID
+}
+
+// notifyIdeaAuthor DMs the author how the review of their idea went.
+func notifyIdeaAuthor(s discordSession, i *idea) {
+	guildName := ideaGuildName(s, i)
+
+	var sb strings.Builder
+	if i.status == ideaApproved {
+		sb.WriteString(fmt.Sprintf("Your idea #%d in '%s' was approved and has been posted", i.id, guildName))
+		if len(i.postedMessageID) > 0 {
+			sb.WriteString(fmt.Sprintf(": https://discord.com/channels/%s/%s/%s", i.guildID, i.postedChannelID, i.postedMessageID))
+		}
+	} else {
+		sb.WriteString(fmt.Sprintf("Your idea #%d in '%s' was not accepted", i.id, guildName))
+	}
+	if len(i.reviewReason) > 0 {
+		sb.WriteString(fmt.Sprintf("\nReason: %s", i.reviewReason))
+	}
+	sb.WriteString(fmt.Sprintf("\n> %s", i.content))
+
+	dm, err := s.UserChannelCreate(i.authorID)
+	if err == nil {
+		_, err = s.ChannelMessageSend(dm.ID, sb.String())
+	}
+	if err != nil {
+		log.Printf("Couldn't tell %s about the review of idea #%d: %s", i.authorID, i.id, err)
 	}
 }
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// useTestIdeas gives the test an ideas store of its own, with a guild that
+// has ideas and queue channels.
+func useTestIdeas(t *testing.T) *fakeSession {
+	useTestStorage(t)
+
+	oldIdeas, oldApprove, oldReject := ideas, ideaApproveCommand, ideaRejectCommand
+	t.Cleanup(func() { ideas, ideaApproveCommand, ideaRejectCommand = oldIdeas, oldApprove, oldReject })
+	ideas = newMemoryIdeaStore()
+	if _, ok := moduleMap[ideasModuleName]; !ok {
+		moduleMap[ideasModuleName] = ideasModule
+		t.Cleanup(func() { delete(moduleMap, ideasModuleName) })
+	}
+	if ideaApproveCommand == nil {
+		ideaApproveCommand = &commandHandler{commandString: "approve", modOnly: true}
+		ideaRejectCommand = &commandHandler{commandString: "reject", modOnly: true}
+	}
+
+	for key, channelID := range map[string]string{configIdeasChannel: "61", configIdeasQueueChannel: "62"} {
+		if err := guildConfigSet("60", key, channelID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f := newFakeSession(&discordgo.User{ID: "100"})
+	f.st.GuildAdd(&discordgo.Guild{
+		ID:    "60",
+		Name:  "guild",
+		Roles: []*discordgo.Role{{ID: "69", Name: "Mod"}},
+		Members: []*discordgo.Member{
+			{GuildID: "60", User: &discordgo.User{ID: "63", Username: "mod"}, Roles: []string{"69"}},
+			{GuildID: "60", User: &discordgo.User{ID: "64", Username: "author"}},
+		},
+	})
+	f.st.ChannelAdd(&discordgo.Channel{ID: "61", GuildID: "60", Name: "ideas"})
+	f.st.ChannelAdd(&discordgo.Channel{ID: "62", GuildID: "60", Name: "ideas-queue"})
+	return f
+}
+
+// addTestIdea sends an idea from the author through the idea command.
+func addTestIdea(t *testing.T, f *fakeSession, guildID string, content string) {
+	t.Helper()
+
+	m := &discordgo.MessageCreate{Message: &discordgo.Message{GuildID: guildID, ChannelID: "65", Author: &discordgo.User{ID: "64", Username: "author"}}}
+	args, err := parseMessageArgs(f, m, []commandArg{{name: "idea", kind: argText}}, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addIdeasHandler(&commandContext{session: f, guildID: guildID, channelID: "65", author: m.Author, args: args, message: m})
+}
+
+func TestAddIdeasHandler(t *testing.T) {
+	tests := []struct {
+		name    string
+		guildID string
+		queued  bool
+	}{
+		{name: "guild with ideas channels", guildID: "60", queued: true},
+		{name: "guild without", guildID: "66"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := useTestIdeas(t)
+			f.st.GuildAdd(&discordgo.Guild{ID: "66", Name: "other guild"})
+
+			addTestIdea(t, f, tt.guildID, "more math")
+
+			if queued := len(f.sentTo("62")) > 0; queued != tt.queued {
+				t.Errorf("queued is %t, want %t", queued, tt.queued)
+			}
+			if _, err := ideas.get(tt.guildID, 1); (err == nil) != tt.queued {
+				t.Errorf("getting the idea gave %v", err)
+			}
+			if replies := f.sentTo("65"); len(replies) != 1 {
+				t.Errorf("replied %+v", replies)
+			}
+		})
+	}
+}
+
+func TestReviewIdeaOnce(t *testing.T) {
+	f := useTestIdeas(t)
+	i := &idea{guildID: "60", authorID: "64", content: "more math"}
+	if err := ideas.add(i); err != nil {
+		t.Fatal(err)
+	}
+
+	// Loaded by three mods before any of them reviewed it
+	first, second, third := *i, *i, *i
+	if err := approveIdea(f, &first, "63", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := approveIdea(f, &second, "65", ""); err == nil {
+		t.Errorf("idea was approved twice")
+	}
+	if err := rejectIdea(f, &third, "66", ""); err == nil {
+		t.Errorf("approved idea was rejected")
+	}
+
+	if posts := len(f.sentTo("61")); posts != 1 {
+		t.Errorf("idea was posted %d times", posts)
+	}
+	if dms := len(f.sentTo("dm-64")); dms != 1 {
+		t.Errorf("author got %d DMs", dms)
+	}
+	if got, _ := ideas.get("60", i.id); got.status != ideaApproved || got.reviewerID != "63" || len(got.postedMessageID) <= 0 {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestApproveIdeaPostFailing(t *testing.T) {
+	f := useTestIdeas(t)
+	i := &idea{guildID: "60", authorID: "64", content: "more math"}
+	if err := ideas.add(i); err != nil {
+		t.Fatal(err)
+	}
+
+	f.failWith("ChannelMessageSend", &discordgo.RESTError{Message: &discordgo.APIErrorMessage{Message: "Missing Access"}})
+	if err := approveIdea(f, i, "63", ""); err == nil {
+		t.Fatal("approving succeeded without posting the idea")
+	}
+	if got, _ := ideas.get("60", i.id); got.status != ideaPending || len(got.reviewerID) > 0 {
+		t.Errorf("idea that couldn't be posted isn't pending anymore: %+v", got)
+	}
+}
+
+func TestIdeasQueueReactionAdd(t *testing.T) {
+	tests := []struct {
+		name   string
+		userID string
+		emoji  string
+		want   ideaStatus
+	}{
+		{name: "mod approves", userID: "63", emoji: "yes", want: ideaApproved},
+		{name: "mod rejects", userID: "63", emoji: "no", want: ideaRejected},
+		{name: "member approves", userID: "64", emoji: "yes", want: ideaPending},
+		{name: "member rejects", userID: "64", emoji: "no", want: ideaPending},
+		{name: "other emoji", userID: "63", emoji: "maybe", want: ideaPending},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := useTestIdeas(t)
+			i := &idea{guildID: "60", authorID: "64", content: "more math", queueChannelID: "62", queueMessageID: "67"}
+			if err := ideas.add(i); err != nil {
+				t.Fatal(err)
+			}
+			if err := ideas.update(i); err != nil {
+				t.Fatal(err)
+			}
+
+			ideasQueueReactionAdd(f, &discordgo.MessageReactionAdd{MessageReaction: &discordgo.MessageReaction{
+				UserID:    tt.userID,
+				MessageID: "67",
+				ChannelID: "62",
+				GuildID:   "60",
+				Emoji:     discordgo.Emoji{Name: tt.emoji},
+			}})
+
+			if got, _ := ideas.get("60", i.id); got.status != tt.want {
+				t.Errorf("idea is %s, want %s", got.status, tt.want)
+			}
+		})
+	}
+}
+
+// staleIdeaStore returns ideas as they were before they got reviewed, like
+// when a mod approves one while the author is withdrawing it.
+type staleIdeaStore struct {
+	ideaStore
+}
+
+func (s staleIdeaStore) get(guildID string, id int) (*idea, error) {
+	i, err := s.ideaStore.get(guildID, id)
+	if err == nil {
+		i.status = ideaPending
+	}
+	return i, err
+}
+
+func TestWithdrawReviewedIdea(t *testing.T) {
+	f := useTestIdeas(t)
+	i := &idea{guildID: "60", authorID: "64", content: "more math"}
+	if err := ideas.add(i); err != nil {
+		t.Fatal(err)
+	}
+	if err := approveIdea(f, i, "63", ""); err != nil {
+		t.Fatal(err)
+	}
+	ideas = staleIdeaStore{ideas}
+
+	ctx := &commandContext{session: f, guildID: "60", channelID: "70", author: &discordgo.User{ID: "64"},
+		args: &commandArgs{values: map[string]interface{}{"id": i.id}}}
+	ideaWithdrawHandler(ctx)
+
+	if got, _ := ideas.(staleIdeaStore).ideaStore.get("60", i.id); got.status != ideaApproved {
+		t.Errorf("approved idea was withdrawn, it's %s", got.status)
+	}
+	if replies := f.sentTo("70"); len(replies) != 1 || !strings.Contains(replies[0].Content, "reviewed in the meantime") {
+		t.Errorf("got replies %+v", replies)
+	}
+}
+
+func TestIdeaQueueModalEdit(t *testing.T) {
+	f := useTestIdeas(t)
+	i := &idea{guildID: "60", authorID: "64", content: "more math"}
+	if err := ideas.add(i); err != nil {
+		t.Fatal(err)
+	}
+
+	ideaQueueModalHandler(f, &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+		Type:      discordgo.InteractionModalSubmit,
+		GuildID:   "60",
+		ChannelID: "62",
+		Member:    &discordgo.Member{User: &discordgo.User{ID: "63"}},
+		Data: discordgo.ModalSubmitInteractionData{
+			CustomID: ideaQueueCustomID("edit", i),
+			Components: []discordgo.MessageComponent{&discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+				&discordgo.TextInput{CustomID: "content", Value: "even more math"},
+			}}},
+		},
+	}}, []string{"edit", "1"})
+
+	if got, _ := ideas.get("60", i.id); got.content != "even more math" || got.status != ideaPending {
+		t.Errorf("got %+v", got)
+	}
+	if dms := f.sentTo("dm-64"); len(dms) != 1 || !strings.Contains(dms[0].Content, "even more math") {
+		t.Errorf("author got DMs %+v", dms)
+	}
+
+	entries, err := auditLog.listByUser("60", "64", auditUserLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) <= 0 || entries[0].action != auditIdeaEdited || entries[0].actorID != "63" {
+		t.Errorf("got audit entries %+v", entries)
+	}
+}
+
+// TestLegacyQueueReactionAdd checks ideas queued as JSON, before ideas were
+// stored, can still be approved.
+func TestLegacyQueueReactionAdd(t *testing.T) {
+	tests := []struct {
+		name      string
+		channelID string
+		emoji     string
+		// reviewed is a reaction already on the queue message
+		reviewed string
+		posted   bool
+	}{
+		{name: "approve", channelID: "62", emoji: "yes", posted: true},
+		{name: "reject", channelID: "62", emoji: "no"},
+		{name: "other emoji", channelID: "62", emoji: "maybe"},
+		{name: "already rejected", channelID: "62", emoji: "yes", reviewed: "no"},
+		{name: "other channel", channelID: "61", emoji: "yes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := useTestIdeas(t)
+			item, _ := json.Marshal(modQueueItem{AuthorID: "64", GuildID: "60", PostingChannelID: "61", Content: "more math"})
+			queued := f.storeMessage("62", &discordgo.MessageSend{Content: string(item)})
+			if len(tt.reviewed) > 0 {
+				queued.Reactions = []*discordgo.MessageReactions{{Count: 1, Emoji: &discordgo.Emoji{Name: tt.reviewed}}}
+			}
+
+			ideasQueueReactionAdd(f, &discordgo.MessageReactionAdd{MessageReaction: &discordgo.MessageReaction{
+				UserID:    "63",
+				MessageID: queued.ID,
+				ChannelID: tt.channelID,
+				GuildID:   "60",
+				Emoji:     discordgo.Emoji{Name: tt.emoji},
+			}})
+
+			posted := f.sentTo("61")
+			if (len(posted) > 0) != tt.posted {
+				t.Fatalf("posted %+v", posted)
+			}
+			if tt.posted && posted[0].Content != "<@64>'s idea: more math" {
+				t.Errorf("posted %q", posted[0].Content)
+			}
+		})
+	}
+}
@@ -10,60 +10,52 @@ import (
 	"os/signal"
 	"regexp"
 	"strconv"
-	"strings"
 	"syscall"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/go-co-op/gocron"
-	_ "github.com/lib/pq"
 )
 
 var (
-	token        string
-	verbose      bool
-	httpPort     int
-	guildID      string
-	modChannelID string
+	token    string
+	verbose  bool
+	httpPort int
+	// guildID is only used to import settings from before they were per guild
+	guildID string
+	// discordURL points VPBot at another server than Discord, like the
+	// fakeDiscord tests use
+	discordURL string
 
-	databaseHost string
-	databaseUser string
-	databasePass string
+	dbConfig databaseConfig
 
 	urlRegex *regexp.Regexp
-	db       *sql.DB
+	db       *storage
 
 	discord *discordgo.Session
+	// botSession is discord for code that isn't handed a session
+	botSession discordSession
 
-	commandMap            = make(map[string]commandHandler)
-	messageStreamHandlers = make([]func(*discordgo.Session, *discordgo.MessageCreate), 0)
+	commandMap            = make(map[string]*commandHandler)
+	commandAliasMap       = make(map[string]*commandHandler)
+	messageStreamHandlers = make([]messageStreamHandler, 0)
 )
 
-type commandHandler struct {
-	commandString string
-	description   string
-	modOnly       bool
-	handleFunc    func(*discordgo.Session, *discordgo.MessageCreate)
-}
-
 func init() {
 	token = os.Getenv("VPBOT_TOKEN")
 	guildID = os.Getenv("VPBOT_GUILD_ID")
-	modChannelID = os.Getenv("VPBOT_MOD_CHAN_ID")
+	discordURL = os.Getenv("VPBOT_DISCORD_URL")
 	verbose, _ = strconv.ParseBool(os.Getenv("VPBOT_VERBOSE"))
 	httpPort, _ = strconv.Atoi(os.Getenv("VPBOT_HTTP_PORT"))
 
-	databaseHost = os.Getenv("VPBOT_DB_HOST")
-	databaseUser = os.Getenv("VPBOT_DB_USER")
-	databasePass = os.Getenv("VPBOT_DB_PASS")
+	dbConfig = loadDatabaseConfig()
 
 	flag.StringVar(&token, "t", token, "Bot Token")
 	flag.BoolVar(&verbose, "v", false, "Verbose Output")
 	flag.IntVar(&httpPort, "p", 13373, "HTTP port")
-	flag.Parse()
 }
 
-func dbPrepare(db *sql.DB, query string) *sql.Stmt {
+func dbPrepare(db *storage, query string) *sql.Stmt {
 	stmt, err := db.Prepare(query)
 	if err != nil {
 		log.Println(err, query)
@@ -73,79 +65,253 @@ func dbPrepare(db *sql.DB, query string) *sql.Stmt {
 }
 
 func main() {
+	// Parsed here rather than in init, so go test can parse its own flags
+	flag.Parse()
 	log.SetFlags(log.Lshortfile)
 
-	if token == "" {
-		log.Println("No token provided. Please run: vpbot -t <bot token> or set the VPBOT_TOKEN environment variable")
+	sc := make(chan os.Signal, 1)
+	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt, syscall.SIGTERM)
+
+	if err := run(sc); err != nil {
+		log.Println(err)
 		os.Exit(1)
 	}
+}
 
-	urlRegex, _ = regexp.Compile(urlRegexString)
-
+// run starts VPBot and keeps it running until something is sent on stop.
+func run(stop <-chan os.Signal) error {
 	var err error
-	db, err = sql.Open("postgres", fmt.Sprintf("host=%s port=5432 user=%s password=%s dbname=vpbot sslmode=disable", databaseHost, databaseUser, databasePass))
+	db, err = openStorage(dbConfig)
 	if err != nil {
-		log.Panic(err)
+		return err
 	}
 
-	cron := gocron.NewScheduler(time.UTC)
+	log.Printf("Connecting to %s database...", db.dialect.name)
+	if err := waitForStorage(db, dbConfig.connectAttempts); err != nil {
+		return err
+	}
 
-	discord, err = discordgo.New("Bot " + token)
-	if err != nil {
-		fmt.Println("error creating Discord session,", err)
-		os.Exit(1)
+	if flag.Arg(0) == "migrate" {
+		runMigrateCommand(db, flag.Args()[1:])
+		return nil
 	}
-	discord.Identify.Intents = discordgo.MakeIntent(discordgo.IntentsAllWithoutPrivileged | discordgo.IntentsGuildMembers)
 
-	log.Println("Opening up connection to discord...")
-	err = discord.Open()
-	if err != nil {
-		fmt.Println("Error opening Discord session: ", err)
-		os.Exit(1)
+	if token == "" {
+		return fmt.Errorf("no token provided. Please run: vpbot -t <bot token> or set the VPBOT_TOKEN environment variable")
 	}
-	//NOTE(Hoej): Needs to be after discord.Open()
-	discord.StateEnabled = true
-
-	initPoliceChannel(discord)
-	initMathSentence(db)
-	initUserTracking(discord, db, cron)
-	initIdeasChannel(discord)
-	initGithubChannel(discord)
-	//initOdin()
-	//initMarkov(db, cron)
-
-	discord.AddHandler(messageCreate)
-	discord.AddHandler(discordReady)
-	discord.AddHandler(ideasQueueReactionAdd)
-	discord.AddHandler(clonexBanProcedure)
 
-	handleCommand("ack", "Will make bot say 'ACK'", false, discordAckHandler)
-	handleCommand("help", "Will print a message with all available commands to the user", false, helpHandler)
-	handleCommand("version", "Will print the version of VPBot", false, versionCommandHandler)
+	initMigrations(db)
+	if err := migrateUp(db, latestMigrationVersion()); err != nil {
+		return err
+	}
 
-	handleCommand("usercount", "Post the current user count for this guild", true, userCountCommandHandler)
+	urlRegex, _ = regexp.Compile(urlRegexString)
+
+	cron := gocron.NewScheduler(time.UTC)
+
+	checkHealth()
+	if _, err := cron.Every(healthCheckInterval).Do(checkHealth); err != nil {
+		return err
+	}
 
-	handleCommand("addidea",
-		"Suggest an idea to add to the server's idea channel, will go into a manual review queue before being posted",
-		false,
-		addIdeasHandler)
+	discord, err = discordgo.New("Bot " + token)
+	if err != nil {
+		return fmt.Errorf("error creating Discord session, %w", err)
+	}
+	if len(discordURL) > 0 {
+		if err := useDiscordURL(discord, discordURL); err != nil {
+			return err
+		}
+	}
+	discord.Identify.Intents = discordgo.MakeIntent(discordgo.IntentsAllWithoutPrivileged | discordgo.IntentsGuildMembers)
+	botSession = liveSession{discord}
 
-	handleCommand("addmathsentence",
-		"Will add a math related sentence that VPBot can say, make sure to make them about hating math",
-		false,
-		addMathSentenceHandler)
+	initGuildConfig(db)
+	initCommandPrefix(db)
+	initCommandPermissions(db)
+	initAuditLog(db)
 
-	//handleCommand("odinrun", "Will compile an odin code block and run it", true, odinRunHandle)
+	// Handlers and commands are set up before connecting, so none of the
+	// events sent right after connecting are missed
+	addSessionHandler(discord, messageCreate)
+	addSessionHandler(discord, discordReady)
+	addSessionHandler(discord, interactionCreate)
+	addSessionHandler(discord, slashGuildCreate)
 
-	//handleCommand("markovsave", "Force a save of the markov chain", true, markovForceSave)
-	//handleCommand("markovsay", "Force a message generation in markov", false, markovForceSay)
+	handleCommand("ack", "Will make bot say 'ACK'", false, discordAckHandler)
+	addCommand(&commandHandler{
+		commandString: "help",
+		description:   "Will print a message with all available commands to the user",
+		ephemeral:     true,
+		args:          helpArgs,
+		checkArgs:     helpCheckArgs,
+		autocomplete:  helpAutocomplete,
+		handleFunc:    helpHandler,
+	})
+	handleCommand("version", "Will print the version of VPBot", false, versionCommandHandler)
 
-	addMessageStreamHandler(msgStreamMathMessageHandler)
-	addMessageStreamHandler(msgStreamPoliceHandler)
-	addMessageStreamHandler(msgStreamGithubMessageHandler)
-	//addMessageStreamHandler(msgStreamMarkovTrainHandler)
-	//addMessageStreamHandler(msgStreamMarkovSayHandler)
+	addCommand(&commandHandler{
+		commandString: "prefix",
+		description:   "Show or change the command prefix used in this server",
+		category:      "Moderation",
+		modOnly:       true,
+		guildOnly:     true,
+		args: []commandArg{
+			{name: "prefix", description: "The new prefix", kind: argString},
+			{name: "reset", description: "Go back to the default prefix", kind: argFlag},
+		},
+		handleFunc: prefixCommandHandler,
+	})
+
+	configGroup := addCommand(&commandHandler{
+		commandString: "config",
+		description:   "View and change VPBot's settings for this server",
+		category:      "Moderation",
+		modOnly:       true,
+		guildOnly:     true,
+	})
+	configKeyArg := commandArg{name: "key", description: "Name of the setting, see config list", kind: argString, required: true, autocomplete: true}
+	addSubcommand(configGroup, &commandHandler{
+		commandString: "list",
+		description:   "List all settings and their current values",
+		aliases:       []string{"ls"},
+		handleFunc:    configListHandler,
+	})
+	addSubcommand(configGroup, &commandHandler{
+		commandString: "get",
+		description:   "Show the current value of a setting",
+		args:          []commandArg{configKeyArg},
+		autocomplete:  configKeyAutocomplete,
+		handleFunc:    configGetHandler,
+	})
+	addSubcommand(configGroup, &commandHandler{
+		commandString: "set",
+		description:   "Change a setting, takes effect right away",
+		args: []commandArg{
+			configKeyArg,
+			{name: "value", description: "Channel or role mention, depending on the setting", kind: argString, required: true},
+		},
+		autocomplete: configKeyAutocomplete,
+		handleFunc:   configSetHandler,
+	})
+	addSubcommand(configGroup, &commandHandler{
+		commandString: "unset",
+		description:   "Remove a setting, turning off what depends on it",
+		aliases:       []string{"reset"},
+		args:          []commandArg{configKeyArg},
+		autocomplete:  configKeyAutocomplete,
+		handleFunc:    configUnsetHandler,
+	})
+
+	permGroup := addCommand(&commandHandler{
+		commandString: "perm",
+		description:   "Control who can use which commands, by user, role, channel or Discord permission",
+		category:      "Moderation",
+		modOnly:       true,
+		guildOnly:     true,
+		aliases:       []string{"permissions"},
+	})
+	permRuleArgs := []commandArg{
+		{name: "command", description: "Full name of the command, eg. \"math add\", or * for all commands", kind: argString, required: true},
+		{name: "target", description: "User, role or channel mention, or a permission like manage_messages", kind: argString, required: true},
+	}
+	addSubcommand(permGroup, &commandHandler{
+		commandString: "allow",
+		description:   "Allow a user, role, channel or permission to use a command",
+		args:          permRuleArgs,
+		handleFunc:    permAllowHandler,
+	})
+	addSubcommand(permGroup, &commandHandler{
+		commandString: "deny",
+		description:   "Deny a user, role, channel or permission from using a command",
+		args:          permRuleArgs,
+		handleFunc:    permDenyHandler,
+	})
+	addSubcommand(permGroup, &commandHandler{
+		commandString: "list",
+		description:   "List the command permissions of this server",
+		aliases:       []string{"ls"},
+		args: []commandArg{
+			{name: "command", description: "Only list permissions for this command", kind: argString},
+		},
+		handleFunc: permListHandler,
+	})
+	addSubcommand(permGroup, &commandHandler{
+		commandString: "remove",
+		description:   "Remove a command permission by its ID, the IDs are shown by perm list",
+		aliases:       []string{"rm", "delete"},
+		args: []commandArg{
+			{name: "id", description: "ID of the permission to remove", kind: argInt, required: true},
+		},
+		handleFunc: permRemoveHandler,
+	})
+
+	auditGroup := addCommand(&commandHandler{
+		commandString: "audit",
+		description:   "Look through the moderation actions taken in this server",
+		category:      "Moderation",
+		modOnly:       true,
+		guildOnly:     true,
+	})
+	addSubcommand(auditGroup, &commandHandler{
+		commandString: "user",
+		description:   "List the moderation actions taken against a user, newest first",
+		args: []commandArg{
+			{name: "user", description: "User to list the actions for", kind: argUser, required: true},
+			{name: "count", description: fmt.Sprintf("How many actions to list, %d by default", auditUserDefault), kind: argInt},
+		},
+		handleFunc: auditUserHandler,
+	})
+
+	moduleGroup := addCommand(&commandHandler{
+		commandString: "module",
+		description:   "Turn VPBot's features on and off for this server",
+		category:      "Moderation",
+		modOnly:       true,
+		guildOnly:     true,
+		aliases:       []string{"modules"},
+	})
+	moduleNameArg := commandArg{name: "module", description: "Name of the module, see module list", kind: argString, required: true, autocomplete: true}
+	addSubcommand(moduleGroup, &commandHandler{
+		commandString: "list",
+		description:   "List all modules and whether they're on in this server",
+		aliases:       []string{"ls"},
+		handleFunc:    moduleListHandler,
+	})
+	addSubcommand(moduleGroup, &commandHandler{
+		commandString: "enable",
+		description:   "Turn a module on in this server",
+		aliases:       []string{"on"},
+		args:          []commandArg{moduleNameArg},
+		autocomplete:  moduleAutocomplete,
+		handleFunc:    moduleEnableHandler,
+	})
+	addSubcommand(moduleGroup, &commandHandler{
+		commandString: "disable",
+		description:   "Turn a module off in this server",
+		aliases:       []string{"off"},
+		args:          []commandArg{moduleNameArg},
+		autocomplete:  moduleAutocomplete,
+		handleFunc:    moduleDisableHandler,
+	})
+
+	addComponentHandler("help", helpPageButtonHandler)
+
+	registerModule(policeModule, db, cron)
+	registerModule(ideasModule, db, cron)
+	registerModule(mathModule, db, cron)
+	registerModule(markovModule, db, cron)
+	registerModule(odinModule, db, cron)
+	registerModule(githubModule, db, cron)
+	registerModule(userTrackingModule, db, cron)
+	registerModule(clonexModule, db, cron)
+	addModuleEventHandlers(discord)
 
+	log.Println("Opening up connection to discord...")
+	err = discord.Open()
+	if err != nil {
+		return fmt.Errorf("error opening Discord session: %w", err)
+	}
 	setupHTTP()
 	log.Printf("Starting HTTP server on port %d...\n", httpPort)
 	go func() {
@@ -159,79 +325,29 @@ func main() {
 	cron.StartAsync()
 
 	log.Println("VPBot is now running.")
-	sc := make(chan os.Signal, 1)
-	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt, syscall.SIGTERM)
-	<-sc
+	<-stop
 	log.Println("VPBot is terminating...")
 
 	cron.Stop()
 	_ = discord.Close()
-
+	return nil
 }
 
 func setupHTTP() {
 	log.Println("Setting up HTTP handlers")
-	http.HandleFunc("/github-webhook", githubWebhookHandler)
 	http.HandleFunc("/ack", ackHandler)
+	http.HandleFunc("/healthz", healthHandler)
 }
 
 func ackHandler(w http.ResponseWriter, _ *http.Request) {
 	_, _ = fmt.Fprintf(w, "ACK")
 }
 
-func addMessageStreamHandler(handler func(*discordgo.Session, *discordgo.MessageCreate)) {
-	messageStreamHandlers = append(messageStreamHandlers, handler)
-}
-
-func handleCommand(cmdString string,
-	desc string,
-	modOnly bool,
-	handler func(*discordgo.Session, *discordgo.MessageCreate)) {
-	if _, ok := commandMap[cmdString]; ok == false {
-		cmdH := commandHandler{
-			cmdString,
-			desc,
-			modOnly,
-			handler,
-		}
-		commandMap[cmdString] = cmdH
-	} else {
-		log.Fatalf("Tried adding handler for '%s' when it already has one!", cmdString)
-	}
-}
-
-func discordAckHandler(session *discordgo.Session, msg *discordgo.MessageCreate) {
-	_, _ = session.ChannelMessageSend(msg.ChannelID, "ACK")
-}
-
-func helpHandler(session *discordgo.Session, msg *discordgo.MessageCreate) {
-	var sb strings.Builder
-
-	user := msg.Author
-	if len(msg.Mentions) > 0 {
-		user = msg.Mentions[0]
-	}
-
-	sb.WriteString("Following commands are available to ")
-	sb.WriteString(user.Mention())
-	sb.WriteString(";\n")
-
-	for _, h := range commandMap {
-		if h.modOnly == false || userAllowedAdminBotCommands(session, msg.GuildID, msg.ChannelID, user.ID) {
-			if len(h.description) > 0 {
-				sb.WriteString("`!")
-				sb.WriteString(h.commandString)
-				sb.WriteString("` ")
-				sb.WriteString(h.description)
-				sb.WriteString("\n")
-			}
-		}
-	}
-
-	_, _ = session.ChannelMessageSend(msg.ChannelID, sb.String())
+func discordAckHandler(ctx *commandContext) {
+	ctx.reply("ACK")
 }
 
-func discordReady(s *discordgo.Session, _ *discordgo.Ready) {
+func discordReady(s discordSession, _ *discordgo.Ready) {
 	activity := discordgo.Activity{
 		Name: "users for fools, one stupid message at a time",
 		Type: discordgo.ActivityTypeGame,
@@ -244,24 +360,13 @@ func discordReady(s *discordgo.Session, _ *discordgo.Ready) {
 	}
 }
 
-func clonexBanProcedure(s *discordgo.Session, e *discordgo.GuildMemberAdd) {
-	if strings.Contains(strings.ToLower(e.User.Username), "clonex") {
-		err := s.GuildBanCreateWithReason(guildID, e.User.ID, "auto ban cause scam bots for clonex", 7)
-		if err != nil {
-			s.ChannelMessageSend(modChannelID, fmt.Sprintf("Unable to ban %v, %v", e.User.Username, err))
-		} else {
-			s.ChannelMessageSend(modChannelID, fmt.Sprintf("Auto banned %v", e.User.Username))
-		}
-	}
-}
-
-func messageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
-	if m.Author.ID == s.State.User.ID {
+func messageCreate(s discordSession, m *discordgo.MessageCreate) {
+	if m.Author.ID == s.state().User.ID {
 		return
 	}
 
-	guild, _ := s.State.Guild(m.GuildID)
-	channel, _ := s.State.Channel(m.ChannelID)
+	guild, _ := s.state().Guild(m.GuildID)
+	channel, _ := s.state().Channel(m.ChannelID)
 
 	log.Printf("[%s|%s|%s#%s] (%s) %s\n",
 		guild.Name,
@@ -271,49 +376,72 @@ func messageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
 		m.ID,
 		m.Content)
 
-	if strings.HasPrefix(m.Content, "!") {
-		message := strings.SplitN(m.Content, " ", 2)
-		cmd := strings.TrimPrefix(message[0], "!")
+	if content, mentioned, ok := stripCommandPrefix(s, m); ok {
+		cmd, rest := splitCommand(content)
 
 		log.Printf("Trying to find %s command for %s", cmd, m.Author.String())
 
-		if handler, ok := commandMap[cmd]; ok {
-			log.Printf("Found %s command for %s", cmd, m.Author.String())
+		handler, ok := lookupCommand(commandMap, commandAliasMap, cmd)
+		if ok {
+			handler, rest = resolveSubcommand(handler, rest)
+			cmd = handler.fullName()
+		}
 
-			if handler.modOnly && userAllowedAdminBotCommands(s, m.GuildID, m.ChannelID, m.Author.ID) == false {
-				log.Printf("User %s tried to use command %s but is not allowed (not a MOD)", m.Author.String(), cmd)
-				_, _ = s.ChannelMessageSend(m.ChannelID, "Sorry, but we're not that type of friends </3")
+		// Mentioning VPBot is also how people talk to it, so only treat it as a
+		// command if it's unambiguously one, "@VPBot math is hard" isn't
+		if ok && mentioned && handler.handleFunc == nil && len(rest) > 0 {
+			ok = false
+		}
+
+		if ok {
+			ctx, err := newMessageCommandContext(s, m, handler, rest)
+			if err != nil && mentioned {
+				log.Printf("Not treating mention from %s as %s command: %s", m.Author.String(), cmd, err)
+			} else if err != nil {
+				log.Printf("Invalid arguments for %s command from %s: %s", cmd, m.Author.String(), err)
+				replyUsage(ctx, err)
+				return
+			} else {
+				log.Printf("Found %s command for %s", cmd, m.Author.String())
+				runCommand(ctx)
 				return
 			}
-
-			log.Printf("Running %s command handler for %s", cmd, m.Author.String())
-			handler.handleFunc(s, m)
-			return
 		}
 	}
 
 	for _, h := range messageStreamHandlers {
-		h(s, m)
+		if moduleEnabled(m.GuildID, h.module) {
+			h.handle(s, m)
+		}
 	}
 }
 
-func userAllowedAdminBotCommands(s *discordgo.Session, guildID string, channelID string, userID string) bool {
+func userAllowedAdminBotCommands(s discordSession, guildID string, channelID string, userID string) bool {
 	perm, _ := s.UserChannelPermissions(userID, channelID)
 	if perm&discordgo.PermissionAdministrator != 0 {
 		return true
 	}
 
-	hasRole := false
-
 	member, _ := s.GuildMember(guildID, userID)
-	if member != nil {
-		guild, _ := s.State.Guild(guildID)
-		for _, x := range guild.Roles {
-			for _, y := range member.Roles {
-				if x.ID == y {
-					if x.Name == "Mod" || x.Name == "mod" {
-						hasRole = true
-					}
+	if member == nil {
+		return false
+	}
+	return hasModRole(s, guildID, member.Roles)
+}
+
+// hasModRole reports whether one of the roles is the guild's Mod role.
+func hasModRole(s discordSession, guildID string, roles []string) bool {
+	guild, _ := s.state().Guild(guildID)
+	if guild == nil {
+		return false
+	}
+
+	hasRole := false
+	for _, x := range guild.Roles {
+		for _, y := range roles {
+			if x.ID == y {
+				if x.Name == "Mod" || x.Name == "mod" {
+					hasRole = true
 				}
 			}
 		}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+var testStorageOnce sync.Once
+
+// openMigratedStorage opens a fresh in memory database with every migration
+// applied.
+func openMigratedStorage() (*storage, error) {
+	s, err := openSQLiteStorage(":memory:")
+	if err != nil {
+		return nil, err
+	}
+	initMigrations(s)
+	return s, migrateUp(s, latestMigrationVersion())
+}
+
+// newTestStorage is a database of the test's own, for testing stores.
+func newTestStorage(t *testing.T) *storage {
+	t.Helper()
+
+	s, err := openMigratedStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// useTestStorage points VPBot at an in memory database, shared by every
+// test as the stores are globals.
+func useTestStorage(t *testing.T) {
+	t.Helper()
+
+	testStorageOnce.Do(func() {
+		s, err := openMigratedStorage()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		db = s
+		initGuildConfig(s)
+		initCommandPrefix(s)
+		initCommandPermissions(s)
+		initAuditLog(s)
+	})
+}
+
+func TestMessageCreateMentions(t *testing.T) {
+	useTestStorage(t)
+
+	cmd, ok := findCommand("mentiontest")
+	if !ok {
+		cmd = addCommand(&commandHandler{
+			commandString: "mentiontest",
+			description:   "Command for testing mentions",
+			args:          []commandArg{{name: "count", kind: argInt, required: true}},
+			checkArgs: func(ctx *commandContext) error {
+				if ctx.args.integer("count") > 10 {
+					return errors.New("`count` is too big")
+				}
+				return nil
+			},
+		})
+	}
+	ran := make([]int, 0)
+	cmd.handleFunc = func(ctx *commandContext) { ran = append(ran, ctx.args.integer("count")) }
+
+	tests := []struct {
+		name    string
+		content string
+		ran     bool
+		replied bool
+	}{
+		{name: "mention", content: "<@100> mentiontest 3", ran: true},
+		{name: "mention with nickname", content: "<@!100> mentiontest 3", ran: true},
+		{name: "mention without arguments", content: "<@100> mentiontest"},
+		{name: "mention with prose", content: "<@100> mentiontest is broken"},
+		{name: "mention failing check", content: "<@100> mentiontest 11"},
+		{name: "mention of unknown command", content: "<@100> hello there"},
+		{name: "prefix", content: "!mentiontest 3", ran: true},
+		{name: "prefix with prose", content: "!mentiontest is broken", replied: true},
+		{name: "prefix failing check", content: "!mentiontest 11", replied: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ran = ran[:0]
+			f := newFakeSession(&discordgo.User{ID: "100"})
+			f.st.GuildAdd(&discordgo.Guild{ID: "10", Name: "guild"})
+			f.st.ChannelAdd(&discordgo.Channel{ID: "20", GuildID: "10", Name: "general"})
+
+			messageCreate(f, &discordgo.MessageCreate{Message: &discordgo.Message{
+				ID:        "30",
+				GuildID:   "10",
+				ChannelID: "20",
+				Content:   tt.content,
+				Author:    &discordgo.User{ID: "40", Username: "someone"},
+			}})
+
+			if got := len(ran) > 0; got != tt.ran {
+				t.Errorf("command ran is %t, want %t", got, tt.ran)
+			}
+			if got := len(f.sentTo("20")) > 0; got != tt.replied {
+				t.Errorf("replied is %t, want %t", got, tt.replied)
+			}
+		})
+	}
+}
+
+// runTested is set once TestRun called run, which can only be called once per
+// process as modules can only be registered once.
+var runTested bool
+
+// TestRun starts VPBot against a fakeDiscord and checks the requests it makes
+// for commands, reactions and members joining.
+func TestRun(t *testing.T) {
+	if runTested {
+		t.Skip("run was already started by an earlier run of this test")
+	}
+	runTested = true
+
+	bot := &discordgo.User{ID: "100", Username: "VPBot", Bot: true}
+	mod := &discordgo.User{ID: "901", Username: "mod"}
+	author := &discordgo.User{ID: "902", Username: "author"}
+	f := newFakeDiscord(bot, &discordgo.Guild{
+		ID:      "900",
+		Name:    "guild",
+		OwnerID: mod.ID,
+		Roles:   []*discordgo.Role{{ID: "900", Name: "@everyone"}},
+		Channels: []*discordgo.Channel{
+			{ID: "910", GuildID: "900", Name: "general", Type: discordgo.ChannelTypeGuildText},
+			{ID: "911", GuildID: "900", Name: "ideas-queue", Type: discordgo.ChannelTypeGuildText},
+			{ID: "912", GuildID: "900", Name: "ideas", Type: discordgo.ChannelTypeGuildText},
+		},
+		Members: []*discordgo.Member{{GuildID: "900", User: mod}, {GuildID: "900", User: author}},
+	})
+	defer f.close()
+
+	token = "test"
+	discordURL = f.url()
+	// Any free port, so tests don't fail because something else has 13373
+	httpPort = 0
+	dbConfig = databaseConfig{driver: "sqlite", path: ":memory:", connectAttempts: 1}
+
+	stop := make(chan os.Signal, 1)
+	done := make(chan error, 1)
+	go func() { done <- run(stop) }()
+	defer func() {
+		stop <- os.Interrupt
+		if err := <-done; err != nil {
+			t.Errorf("run returned %s", err)
+		}
+	}()
+
+	if err := f.waitReady(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("prefix command", func(t *testing.T) {
+		err := f.dispatch("MESSAGE_CREATE", &discordgo.Message{
+			ID:        "940",
+			GuildID:   "900",
+			ChannelID: "910",
+			Content:   "!ack",
+			Author:    author,
+			Timestamp: time.Now(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := f.waitForRequest("POST", "/channels/910/messages", 5*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(req.body), "ACK") {
+			t.Errorf("replied with %s", req.body)
+		}
+	})
+
+	t.Run("slash interaction", func(t *testing.T) {
+		err := f.dispatch("INTERACTION_CREATE", map[string]interface{}{
+			"id":             "920",
+			"application_id": bot.ID,
+			"type":           discordgo.InteractionApplicationCommand,
+			"guild_id":       "900",
+			"channel_id":     "910",
+			"token":          "interaction-token",
+			"member":         &discordgo.Member{User: author},
+			"data":           map[string]interface{}{"id": "930", "name": "ack", "type": discordgo.ChatApplicationCommand},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := f.waitForRequest("POST", "/interactions/920/interaction-token/callback", 5*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(req.body), "ACK") {
+			t.Errorf("responded with %s", req.body)
+		}
+	})
+
+	t.Run("reaction", func(t *testing.T) {
+		if err := guildConfigSet("900", configIdeasQueueChannel, "911"); err != nil {
+			t.Fatal(err)
+		}
+		if err := guildConfigSet("900", configIdeasChannel, "912"); err != nil {
+			t.Fatal(err)
+		}
+		i := &idea{guildID: "900", authorID: author.ID, content: "more math"}
+		if err := ideas.add(i); err != nil {
+			t.Fatal(err)
+		}
+		i.queueChannelID, i.queueMessageID = "911", "950"
+		if err := ideas.update(i); err != nil {
+			t.Fatal(err)
+		}
+		f.addMessage(&discordgo.Message{ID: "950", ChannelID: "911", Author: bot})
+
+		err := f.dispatch("MESSAGE_REACTION_ADD", &discordgo.MessageReaction{
+			UserID:    mod.ID,
+			MessageID: "950",
+			ChannelID: "911",
+			GuildID:   "900",
+			Emoji:     discordgo.Emoji{Name: "yes"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := f.waitForRequest("POST", "/channels/912/messages", 5*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(req.body), "more math") {
+			t.Errorf("posted %s", req.body)
+		}
+		if _, err := f.waitForRequest("POST", "/users/@me/channels", 5*time.Second); err != nil {
+			t.Errorf("author wasn't told: %s", err)
+		}
+		if _, err := f.waitForRequest("PATCH", "/channels/911/messages/950", 5*time.Second); err != nil {
+			t.Errorf("queue message wasn't updated: %s", err)
+		}
+	})
+
+	t.Run("member join", func(t *testing.T) {
+		if err := guildConfigSet("900", configModChannel, "913"); err != nil {
+			t.Fatal(err)
+		}
+
+		err := f.dispatch("GUILD_MEMBER_ADD", &discordgo.Member{
+			GuildID: "900",
+			User:    &discordgo.User{ID: "903", Username: "CloneX Mint"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := f.waitForRequest("PUT", "/guilds/900/bans/903", 5*time.Second); err != nil {
+			t.Fatal(err)
+		}
+		req, err := f.waitForRequest("POST", "/channels/913/messages", 5*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(req.body), "Auto banned CloneX Mint") {
+			t.Errorf("told the mods %s", req.body)
+		}
+	})
+}
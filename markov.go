@@ -1,7 +1,6 @@
 package main
 
 import (
-	"database/sql"
 	"encoding/json"
 	"log"
 	"strings"
@@ -11,44 +10,58 @@ import (
 	"github.com/mb-14/gomarkov"
 )
 
+const markovModuleName = "markov"
+
 var (
-	insertMarkovVersion *sql.Stmt
-	chain               *gomarkov.Chain
+	markovModule = &module{
+		name:        markovModuleName,
+		description: "Learn from messages and generate new ones with a markov chain",
+		setup:       setupMarkovModule,
+	}
+
+	chain *gomarkov.Chain
 )
 
-func initMarkov(db *sql.DB, scheduler *gocron.Scheduler) {
-	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS markov (id INTEGER PRIMARY KEY, create_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP, json TEXT)`)
-	if err != nil {
-		log.Panic(err)
-	}
+func setupMarkovModule(m *module, db *storage, scheduler *gocron.Scheduler) {
+	initMarkov(db, scheduler)
+
+	m.addCommand(&commandHandler{
+		commandString: "markovsave",
+		description:   "Force a save of the markov chain",
+		modOnly:       true,
+		handleFunc:    markovForceSave,
+	})
+	m.addCommand(&commandHandler{
+		commandString: "markovsay",
+		description:   "Force a message generation in markov",
+		handleFunc:    markovForceSay,
+	})
+
+	m.addStreamHandler(msgStreamMarkovTrainHandler)
+	m.addStreamHandler(msgStreamMarkovSayHandler)
+}
 
-	insertMarkovVersion = dbPrepare(db, "INSERT INTO markov (json) VALUES (?)")
+func initMarkov(db *storage, scheduler *gocron.Scheduler) {
+	markovModels = newSQLMarkovStore(db)
 
 	chain = GetMarkovChain()
 
 	scheduler.Every(2).Hours().Do(saveMarkovChain)
 }
 
-func markovForceSave(session *discordgo.Session, msg *discordgo.MessageCreate) {
+func markovForceSave(ctx *commandContext) {
 	saveMarkovChain()
-	session.ChannelMessageSend(msg.ChannelID, "Saved chain...")
+	ctx.reply("Saved chain...")
 }
 
-func markovForceSay(session *discordgo.Session, msg *discordgo.MessageCreate) {
-	content, _ := msg.ContentWithMoreMentionsReplaced(session)
-
-	sentence := strings.TrimPrefix(content, "!markovsay")
-	sentence = strings.TrimSpace(sentence)
-
+func markovForceSay(ctx *commandContext) {
 	message := markovGenerateMessage()
-	session.ChannelMessageSend(msg.ChannelID, message)
+	ctx.reply(message)
 }
 
 func GetMarkovChain() *gomarkov.Chain {
 	var result *gomarkov.Chain
-	row := db.QueryRow("SELECT json FROM markov ORDER BY create_time DESC LIMIT 1")
-	var model string
-	err := row.Scan(&model)
+	model, err := markovModels.latest()
 	if err != nil {
 		log.Println("No markov model found in DB, creating fresh one")
 		result = gomarkov.NewChain(2)
@@ -66,16 +79,27 @@ func GetMarkovChain() *gomarkov.Chain {
 }
 
 func saveMarkovChain() {
+	// Nothing is learned while the module is off everywhere
+	enabled := false
+	for _, guildID := range connectedGuildIDs(botSession) {
+		enabled = enabled || moduleEnabledByName(guildID, markovModuleName)
+	}
+	if enabled == false {
+		return
+	}
+
 	json, _ := chain.MarshalJSON()
-	insertMarkovVersion.Exec(string(json))
+	if err := markovModels.save(string(json)); err != nil {
+		log.Printf("Error trying to save markov chain: %s", err)
+	}
 }
 
-func msgStreamMarkovTrainHandler(session *discordgo.Session, msg *discordgo.MessageCreate) {
-	if msg.Author.ID == session.State.User.ID {
+func msgStreamMarkovTrainHandler(session discordSession, msg *discordgo.MessageCreate) {
+	if msg.Author.ID == session.state().User.ID {
 		return
 	}
 
-	content, err := msg.ContentWithMoreMentionsReplaced(session)
+	content, err := msg.ContentWithMoreMentionsReplaced(stateSession(session))
 	if err != nil {
 		log.Printf("Couldn't replace all mentions in '%s'\n", content)
 	}
@@ -85,13 +109,13 @@ func msgStreamMarkovTrainHandler(session *discordgo.Session, msg *discordgo.Mess
 	chain.Add(data)
 }
 
-func msgStreamMarkovSayHandler(session *discordgo.Session, msg *discordgo.MessageCreate) {
-	if msg.Author.ID == session.State.User.ID {
+func msgStreamMarkovSayHandler(session discordSession, msg *discordgo.MessageCreate) {
+	if msg.Author.ID == session.state().User.ID {
 		return
 	}
 
 	//for _, mention := range msg.Mentions {
-	//	if mention.ID == session.State.User.ID {
+	//	if mention.ID == session.state().User.ID {
 	//		if rand.Float32() > 0.75 {
 	//			markovMsg := markovGenerateMessage()
 	//			session.ChannelMessageSend(msg.ChannelID, markovMsg)
@@ -0,0 +1,33 @@
+package main
+
+import "database/sql"
+
+// markovStore keeps every saved version of the markov model as JSON.
+type markovStore interface {
+	// latest returns errNotFound if no model has been saved
+	latest() (string, error)
+	save(model string) error
+}
+
+type sqlMarkovStore struct {
+	queryLatest *sql.Stmt
+	insert      *sql.Stmt
+}
+
+func newSQLMarkovStore(db *storage) *sqlMarkovStore {
+	return &sqlMarkovStore{
+		queryLatest: dbPrepare(db, "SELECT json FROM markov ORDER BY create_time DESC, id DESC LIMIT 1"),
+		insert:      dbPrepare(db, "INSERT INTO markov (json) VALUES ($1)"),
+	}
+}
+
+func (s *sqlMarkovStore) latest() (string, error) {
+	var model string
+	err := s.queryLatest.QueryRow().Scan(&model)
+	return model, notFound(err)
+}
+
+func (s *sqlMarkovStore) save(model string) error {
+	_, err := s.insert.Exec(model)
+	return err
+}
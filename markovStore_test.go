@@ -0,0 +1,67 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestMarkovStore(t *testing.T) {
+	tests := []struct {
+		name   string
+		models []string
+		want   string
+		err    error
+	}{
+		{name: "nothing saved", err: errNotFound},
+		{name: "one", models: []string{"{}"}, want: "{}"},
+		{name: "latest", models: []string{`{"a":1}`, `{"a":2}`, `{"a":3}`}, want: `{"a":3}`},
+	}
+
+	for _, tt := range tests {
+		stores := map[string]markovStore{
+			"sql":    newSQLMarkovStore(newTestStorage(t)),
+			"memory": newMemoryMarkovStore(),
+		}
+		for name, s := range stores {
+			t.Run(tt.name+"/"+name, func(t *testing.T) {
+				for _, m := range tt.models {
+					if err := s.save(m); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				got, err := s.latest()
+				if got != tt.want || err != tt.err {
+					t.Errorf("got '%s', err %v, want '%s', err %v", got, err, tt.want, tt.err)
+				}
+			})
+		}
+	}
+}
+
+type memoryMarkovStore struct {
+	mutex  sync.Mutex
+	models []string
+}
+
+func newMemoryMarkovStore() *memoryMarkovStore {
+	return &memoryMarkovStore{}
+}
+
+func (s *memoryMarkovStore) latest() (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.models) <= 0 {
+		return "", errNotFound
+	}
+	return s.models[len(s.models)-1], nil
+}
+
+func (s *memoryMarkovStore) save(model string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.models = append(s.models, model)
+	return nil
+}
@@ -1,40 +1,71 @@
 package main
 
 import (
-	"database/sql"
 	"fmt"
 	"log"
 	"strings"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
+	"github.com/go-co-op/gocron"
 )
 
-var (
-	queryRandomMathSentence  *sql.Stmt
-	insertRandomMathSentence *sql.Stmt
-)
+var mathModule = &module{
+	name:           "math",
+	description:    "Make VPBot complain about math when mentioned together with it",
+	defaultEnabled: true,
+	setup:          setupMathModule,
+}
 
-func initMathSentence(db *sql.DB) {
-	_, err := db.Exec("CREATE TABLE IF NOT EXISTS math_sentence (id SERIAL PRIMARY KEY, sentence TEXT)")
-	if err != nil {
-		log.Panic(err)
-	}
+func setupMathModule(m *module, db *storage, _ *gocron.Scheduler) {
+	mathSentences = newSQLMathSentenceStore(db)
 
-	queryRandomMathSentence = dbPrepare(db, "SELECT sentence FROM math_sentence ORDER BY random() LIMIT 1")
-	insertRandomMathSentence = dbPrepare(db, "INSERT INTO math_sentence (sentence) VALUES ($1)")
+	mathGroup := m.addCommand(&commandHandler{
+		commandString: "math",
+		description:   "Manage the sentences VPBot says when someone mentions math",
+		category:      "Math",
+		ephemeral:     true,
+	})
+	mathAdd := addSubcommand(mathGroup, &commandHandler{
+		commandString: "add",
+		description:   "Will add a math related sentence that VPBot can say, make sure to make them about hating math",
+		cooldown:      commandCooldown{user: time.Minute, global: 5 * time.Second},
+		args: []commandArg{
+			{name: "sentence", description: "The sentence VPBot should say", kind: argText, required: true},
+		},
+		handleFunc: addMathSentenceHandler,
+	})
+	addSubcommand(mathGroup, &commandHandler{
+		commandString: "list",
+		description:   "List all the math sentences VPBot can say",
+		aliases:       []string{"ls"},
+		modOnly:       true,
+		handleFunc:    listMathSentenceHandler,
+	})
+	addSubcommand(mathGroup, &commandHandler{
+		commandString: "remove",
+		description:   "Remove a math sentence by its ID, the IDs are shown by math list",
+		aliases:       []string{"rm", "delete"},
+		modOnly:       true,
+		args: []commandArg{
+			{name: "id", description: "ID of the sentence to remove", kind: argInt, required: true},
+		},
+		handleFunc: removeMathSentenceHandler,
+	})
+	addCommandAlias("addmathsentence", mathAdd)
+
+	m.addStreamHandler(msgStreamMathMessageHandler)
 }
 
-func msgStreamMathMessageHandler(session *discordgo.Session, msg *discordgo.MessageCreate) {
+func msgStreamMathMessageHandler(session discordSession, msg *discordgo.MessageCreate) {
 	if len(msg.Mentions) > 0 {
 		for _, mention := range msg.Mentions {
-			if mention.ID == session.State.User.ID {
+			if mention.ID == session.state().User.ID {
 				str := strings.ToLower(msg.Content)
 				if strings.Contains(str, "math") {
 
-					var sentence string
-					row := queryRandomMathSentence.QueryRow()
-					err := row.Scan(&sentence)
-					if err == sql.ErrNoRows {
+					sentence, err := mathSentences.random()
+					if err == errNotFound {
 						sentence = "MATH IS THE WORST THING ON EARH"
 					}
 
@@ -53,13 +84,58 @@ func msgStreamMathMessageHandler(session *discordgo.Session, msg *discordgo.Mess
 	}
 }
 
-func addMathSentenceHandler(session *discordgo.Session, msg *discordgo.MessageCreate) {
-	sentence := strings.TrimPrefix(msg.Content, "!addmathsentence")
-	sentence = strings.TrimSpace(sentence)
+func addMathSentenceHandler(ctx *commandContext) {
+	sentence := ctx.args.text("sentence")
 	if len(sentence) <= 1 {
-		session.ChannelMessageSend(msg.ChannelID, "Remember to include sentence in command...")
+		ctx.reply("Remember to include sentence in command...")
+		return
+	}
+	if err := mathSentences.add(sentence); err != nil {
+		log.Printf("Error trying to add math sentence: %s", err)
+		ctx.reply("Couldn't add the sentence, try again later")
+		return
+	}
+	ctx.reply("Added sentence to set! o7")
+}
+
+func listMathSentenceHandler(ctx *commandContext) {
+	sentences, err := mathSentences.all()
+	if err != nil {
+		log.Printf("Error trying to list math sentences: %s", err)
+		ctx.reply("Couldn't get the math sentences, try again later")
+		return
+	}
+
+	var sb strings.Builder
+	for _, m := range sentences {
+		line := fmt.Sprintf("`%d` %s\n", m.id, m.sentence)
+		// Stay below Discord's message limit, splitting into several messages
+		if sb.Len()+len(line) > 1900 {
+			ctx.reply(sb.String())
+			sb.Reset()
+		}
+		sb.WriteString(line)
+	}
+
+	if sb.Len() <= 0 {
+		ctx.reply(fmt.Sprintf("There are no math sentences yet, add one with `%smath add`", ctx.prefix()))
+		return
+	}
+	ctx.reply(sb.String())
+}
+
+func removeMathSentenceHandler(ctx *commandContext) {
+	id := ctx.args.integer("id")
+	removed, err := mathSentences.remove(id)
+	if err != nil {
+		log.Printf("Error trying to remove math sentence %d: %s", id, err)
+		ctx.reply("Couldn't remove the sentence, try again later")
+		return
+	}
+
+	if removed == false {
+		ctx.reply(fmt.Sprintf("There is no math sentence with ID %d", id))
 		return
 	}
-	insertRandomMathSentence.Exec(sentence)
-	session.ChannelMessageSend(msg.ChannelID, "Added sentence to set! o7")
+	ctx.reply(fmt.Sprintf("Removed math sentence %d", id))
 }
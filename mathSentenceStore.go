@@ -0,0 +1,73 @@
+package main
+
+import (
+	"database/sql"
+)
+
+type mathSentence struct {
+	id       int
+	sentence string
+}
+
+type mathSentenceStore interface {
+	// random returns errNotFound if there are no sentences
+	random() (string, error)
+	add(sentence string) error
+	all() ([]mathSentence, error)
+	// remove reports whether there was a sentence with the ID
+	remove(id int) (bool, error)
+}
+
+type sqlMathSentenceStore struct {
+	queryRandom *sql.Stmt
+	queryAll    *sql.Stmt
+	insert      *sql.Stmt
+	delete      *sql.Stmt
+}
+
+func newSQLMathSentenceStore(db *storage) *sqlMathSentenceStore {
+	return &sqlMathSentenceStore{
+		queryRandom: dbPrepare(db, "SELECT sentence FROM math_sentence ORDER BY random() LIMIT 1"),
+		queryAll:    dbPrepare(db, "SELECT id, sentence FROM math_sentence ORDER BY id"),
+		insert:      dbPrepare(db, "INSERT INTO math_sentence (sentence) VALUES ($1)"),
+		delete:      dbPrepare(db, "DELETE FROM math_sentence WHERE id = $1"),
+	}
+}
+
+func (s *sqlMathSentenceStore) random() (string, error) {
+	var sentence string
+	err := s.queryRandom.QueryRow().Scan(&sentence)
+	return sentence, notFound(err)
+}
+
+func (s *sqlMathSentenceStore) add(sentence string) error {
+	_, err := s.insert.Exec(sentence)
+	return err
+}
+
+func (s *sqlMathSentenceStore) all() ([]mathSentence, error) {
+	rows, err := s.queryAll.Query()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]mathSentence, 0)
+	for rows.Next() {
+		var m mathSentence
+		if err := rows.Scan(&m.id, &m.sentence); err != nil {
+			return nil, err
+		}
+		result = append(result, m)
+	}
+	return result, rows.Err()
+}
+
+func (s *sqlMathSentenceStore) remove(id int) (bool, error) {
+	res, err := s.delete.Exec(id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
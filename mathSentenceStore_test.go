@@ -0,0 +1,119 @@
+package main
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestMathSentenceStore(t *testing.T) {
+	tests := []struct {
+		name      string
+		sentences []string
+		remove    []int
+		removed   []bool
+		want      []string
+	}{
+		{name: "nothing", want: []string{}},
+		{name: "added", sentences: []string{"1 + 1", "2 + 2"}, want: []string{"1 + 1", "2 + 2"}},
+		{name: "removed", sentences: []string{"1 + 1", "2 + 2", "3 + 3"}, remove: []int{2, 2, 9}, removed: []bool{true, false, false}, want: []string{"1 + 1", "3 + 3"}},
+	}
+
+	for _, tt := range tests {
+		stores := map[string]mathSentenceStore{
+			"sql":    newSQLMathSentenceStore(newTestStorage(t)),
+			"memory": newMemoryMathSentenceStore(),
+		}
+		for name, s := range stores {
+			t.Run(tt.name+"/"+name, func(t *testing.T) {
+				for _, sentence := range tt.sentences {
+					if err := s.add(sentence); err != nil {
+						t.Fatal(err)
+					}
+				}
+				for n, id := range tt.remove {
+					if ok, err := s.remove(id); ok != tt.removed[n] || err != nil {
+						t.Errorf("removing %d returned %t, err %v", id, ok, err)
+					}
+				}
+
+				all, err := s.all()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(all) != len(tt.want) {
+					t.Fatalf("got %+v, want %v", all, tt.want)
+				}
+				for n, m := range all {
+					if m.sentence != tt.want[n] {
+						t.Errorf("sentence %d is '%s', want '%s'", n, m.sentence, tt.want[n])
+					}
+				}
+
+				sentence, err := s.random()
+				if len(tt.want) <= 0 {
+					if err != errNotFound {
+						t.Errorf("random without sentences returned '%s', err %v", sentence, err)
+					}
+					return
+				}
+				found := false
+				for _, want := range tt.want {
+					found = found || want == sentence
+				}
+				if err != nil || !found {
+					t.Errorf("random returned '%s', err %v", sentence, err)
+				}
+			})
+		}
+	}
+}
+
+type memoryMathSentenceStore struct {
+	mutex     sync.Mutex
+	nextID    int
+	sentences map[int]string
+}
+
+func newMemoryMathSentenceStore() *memoryMathSentenceStore {
+	return &memoryMathSentenceStore{nextID: 1, sentences: make(map[int]string)}
+}
+
+func (s *memoryMathSentenceStore) random() (string, error) {
+	all, _ := s.all()
+	if len(all) <= 0 {
+		return "", errNotFound
+	}
+	return all[rand.Intn(len(all))].sentence, nil
+}
+
+func (s *memoryMathSentenceStore) add(sentence string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.sentences[s.nextID] = sentence
+	s.nextID++
+	return nil
+}
+
+func (s *memoryMathSentenceStore) all() ([]mathSentence, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	result := make([]mathSentence, 0, len(s.sentences))
+	for id, sentence := range s.sentences {
+		result = append(result, mathSentence{id, sentence})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].id < result[j].id })
+	return result, nil
+}
+
+func (s *memoryMathSentenceStore) remove(id int) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	_, ok := s.sentences[id]
+	delete(s.sentences, id)
+	return ok, nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestMsgStreamMathMessageHandler(t *testing.T) {
+	bot := &discordgo.User{ID: "100"}
+	author := &discordgo.User{ID: "40"}
+	friend := &discordgo.User{ID: "41"}
+
+	tests := []struct {
+		name      string
+		content   string
+		mentions  []*discordgo.User
+		sentences []string
+		want      string
+	}{
+		{name: "mention with math", content: "<@100> do my math homework", mentions: []*discordgo.User{bot}, sentences: []string{"no."}, want: "<@40> no."},
+		{name: "mention with math for a friend", content: "<@100> <@41> likes math", mentions: []*discordgo.User{bot, friend}, sentences: []string{"no."}, want: "<@41> no."},
+		{name: "no sentences", content: "<@100> MATH", mentions: []*discordgo.User{bot}, want: "<@40> MATH IS THE WORST THING ON EARH"},
+		{name: "mention without math", content: "<@100> hello", mentions: []*discordgo.User{bot}, sentences: []string{"no."}},
+		{name: "math without mention", content: "I like math", sentences: []string{"no."}},
+		{name: "someone else mentioned", content: "<@41> math", mentions: []*discordgo.User{friend}, sentences: []string{"no."}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oldSentences := mathSentences
+			t.Cleanup(func() { mathSentences = oldSentences })
+			mathSentences = newMemoryMathSentenceStore()
+			for _, s := range tt.sentences {
+				if err := mathSentences.add(s); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			f := newFakeSession(bot)
+			msgStreamMathMessageHandler(f, &discordgo.MessageCreate{Message: &discordgo.Message{
+				ID:        "30",
+				GuildID:   "10",
+				ChannelID: "20",
+				Content:   tt.content,
+				Author:    author,
+				Mentions:  tt.mentions,
+			}})
+
+			sent := f.sentTo("20")
+			if len(tt.want) <= 0 {
+				if len(sent) > 0 {
+					t.Errorf("replied %+v", sent)
+				}
+				return
+			}
+			if len(sent) != 1 || sent[0].Content != tt.want {
+				t.Errorf("replied %+v, want %q", sent, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+type migration struct {
+	version     int
+	description string
+	// up and down are written for Postgres, see dialect.schema
+	up   string
+	down string
+	// only is set for migrations that only apply to one database, others
+	// just record them as applied
+	only *dialect
+}
+
+// migrations are applied in order of version, never change one that has been
+// released, add a new one fixing it instead.
+var migrations = []migration{
+	{
+		version:     1,
+		description: "Tables created before migrations existed",
+		// IF NOT EXISTS as these already exist in databases from before
+		up: `
+			CREATE TABLE IF NOT EXISTS math_sentence (id SERIAL PRIMARY KEY, sentence TEXT);
+			CREATE TABLE IF NOT EXISTS user_track_data (id INTEGER PRIMARY KEY, guild_id TEXT, week_number INT, year INT, user_count INT);
+			CREATE TABLE IF NOT EXISTS markov (id SERIAL PRIMARY KEY, create_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP, json TEXT);
+			CREATE TABLE IF NOT EXISTS guild_config (guild_id TEXT NOT NULL, key TEXT NOT NULL, value TEXT NOT NULL, PRIMARY KEY (guild_id, key));
+			CREATE TABLE IF NOT EXISTS guild_prefix (guild_id TEXT PRIMARY KEY, prefix TEXT NOT NULL);
+			CREATE TABLE IF NOT EXISTS command_permission (
+				id SERIAL PRIMARY KEY,
+				guild_id TEXT NOT NULL,
+				command TEXT NOT NULL,
+				target_type TEXT NOT NULL,
+				target_id TEXT NOT NULL,
+				allow BOOLEAN NOT NULL);`,
+		down: `
+			DROP TABLE IF EXISTS command_permission;
+			DROP TABLE IF EXISTS guild_prefix;
+			DROP TABLE IF EXISTS guild_config;
+			DROP TABLE IF EXISTS markov;
+			DROP TABLE IF EXISTS user_track_data;
+			DROP TABLE IF EXISTS math_sentence;`,
+	},
+	{
+		version:     2,
+		description: "Generate user_track_data IDs, inserts without one used to fail",
+		// SQLite generates IDs for INTEGER PRIMARY KEY columns already
+		only: postgresDialect,
+		up: `
+			CREATE SEQUENCE IF NOT EXISTS user_track_data_id_seq OWNED BY user_track_data.id;
+			SELECT setval('user_track_data_id_seq', COALESCE((SELECT MAX(id) FROM user_track_data), 0) + 1, false);
+			ALTER TABLE user_track_data ALTER COLUMN id SET DEFAULT nextval('user_track_data_id_seq');`,
+		down: `
+			ALTER TABLE user_track_data ALTER COLUMN id DROP DEFAULT;
+			DROP SEQUENCE IF EXISTS user_track_data_id_seq;`,
+	},
+	{
+		version:     3,
+		description: "Keep suggested ideas",
+		up: `
+			CREATE TABLE ideas (
+				id SERIAL PRIMARY KEY,
+				guild_id TEXT NOT NULL,
+				author_id TEXT NOT NULL,
+				content TEXT NOT NULL,
+				created_at TIMESTAMP NOT NULL);`,
+		down: `DROP TABLE ideas;`,
+	},
+	{
+		version:     4,
+		description: "Track ideas through review",
+		up: `
+			ALTER TABLE ideas ADD COLUMN status TEXT NOT NULL DEFAULT 'pending';
+			ALTER TABLE ideas ADD COLUMN updated_at TIMESTAMP;
+			UPDATE ideas SET updated_at = created_at;
+			ALTER TABLE ideas ADD COLUMN reviewer_id TEXT NOT NULL DEFAULT '';
+			ALTER TABLE ideas ADD COLUMN reviewed_at TIMESTAMP;
+			ALTER TABLE ideas ADD COLUMN queue_message_id TEXT NOT NULL DEFAULT '';
+			ALTER TABLE ideas ADD COLUMN posted_channel_id TEXT NOT NULL DEFAULT '';
+			ALTER TABLE ideas ADD COLUMN posted_message_id TEXT NOT NULL DEFAULT '';
+			CREATE INDEX ideas_status ON ideas (guild_id, status);`,
+		down: `
+			DROP INDEX ideas_status;
+			ALTER TABLE ideas DROP COLUMN posted_message_id;
+			ALTER TABLE ideas DROP COLUMN posted_channel_id;
+			ALTER TABLE ideas DROP COLUMN queue_message_id;
+			ALTER TABLE ideas DROP COLUMN reviewed_at;
+			ALTER TABLE ideas DROP COLUMN reviewer_id;
+			ALTER TABLE ideas DROP COLUMN updated_at;
+			ALTER TABLE ideas DROP COLUMN status;`,
+	},
+	{
+		version:     5,
+		description: "Keep why ideas were reviewed and where they were queued",
+		up: `
+			ALTER TABLE ideas ADD COLUMN review_reason TEXT NOT NULL DEFAULT '';
+			ALTER TABLE ideas ADD COLUMN queue_channel_id TEXT NOT NULL DEFAULT '';
+			CREATE INDEX ideas_queue_message ON ideas (guild_id, queue_message_id);`,
+		down: `
+			DROP INDEX ideas_queue_message;
+			ALTER TABLE ideas DROP COLUMN queue_channel_id;
+			ALTER TABLE ideas DROP COLUMN review_reason;`,
+	},
+	{
+		version:     6,
+		description: "Votes on posted ideas",
+		up: `
+			CREATE TABLE idea_votes (
+				guild_id TEXT NOT NULL,
+				idea_id INT NOT NULL,
+				user_id TEXT NOT NULL,
+				value INT NOT NULL,
+				voted_at TIMESTAMP NOT NULL,
+				PRIMARY KEY (idea_id, user_id));
+			CREATE INDEX idea_votes_guild ON idea_votes (guild_id, voted_at);
+			CREATE INDEX ideas_posted_message ON ideas (guild_id, posted_message_id);`,
+		down: `
+			DROP INDEX ideas_posted_message;
+			DROP TABLE idea_votes;`,
+	},
+	{
+		version:     7,
+		description: "Remember which ideas a new idea looked like",
+		up:          `ALTER TABLE ideas ADD COLUMN similar_ids TEXT NOT NULL DEFAULT '';`,
+		down:        `ALTER TABLE ideas DROP COLUMN similar_ids;`,
+	},
+	{
+		version:     8,
+		description: "Keep the files uploaded with ideas",
+		up:          `ALTER TABLE ideas ADD COLUMN attachment_urls TEXT NOT NULL DEFAULT '';`,
+		down:        `ALTER TABLE ideas DROP COLUMN attachment_urls;`,
+	},
+	{
+		version:     9,
+		description: "Rules for policed channels",
+		up: `
+			CREATE TABLE police_rules (
+				id SERIAL PRIMARY KEY,
+				guild_id TEXT NOT NULL,
+				channel_id TEXT NOT NULL,
+				kind TEXT NOT NULL,
+				value TEXT NOT NULL,
+				action TEXT NOT NULL,
+				message TEXT NOT NULL);
+			CREATE INDEX police_rules_guild ON police_rules (guild_id);
+			CREATE TABLE police_posts (
+				channel_id TEXT NOT NULL,
+				user_id TEXT NOT NULL,
+				posted_at TIMESTAMP NOT NULL);
+			CREATE INDEX police_posts_user ON police_posts (channel_id, user_id, posted_at);`,
+		down: `
+			DROP TABLE police_posts;
+			DROP TABLE police_rules;`,
+	},
+	{
+		version:     10,
+		description: "Audit log of moderation actions",
+		up: `
+			CREATE TABLE audit_log (
+				id SERIAL PRIMARY KEY,
+				guild_id TEXT NOT NULL,
+				action TEXT NOT NULL,
+				actor_id TEXT NOT NULL,
+				target_id TEXT NOT NULL,
+				channel_id TEXT NOT NULL,
+				details TEXT NOT NULL,
+				created_at TIMESTAMP NOT NULL);
+			CREATE INDEX audit_log_target ON audit_log (guild_id, target_id, created_at);`,
+		down: `DROP TABLE audit_log;`,
+	},
+}
+
+func initMigrations(db *storage) {
+	_, err := db.Exec("CREATE TABLE IF NOT EXISTS schema_migrations (version INT PRIMARY KEY, description TEXT NOT NULL, applied_at TIMESTAMP NOT NULL)")
+	if err != nil {
+		log.Panic(err)
+	}
+}
+
+// appliedMigrations returns the versions currently applied to the database.
+func appliedMigrations(db *storage) (map[int]time.Time, error) {
+	rows, err := db.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		result[version] = appliedAt
+	}
+	return result, rows.Err()
+}
+
+func latestMigrationVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// migrateUp applies every migration up to and including target that hasn't
+// been applied yet, each in its own transaction.
+func migrateUp(db *storage, target int) error {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.version > target {
+			break
+		}
+		if _, ok := applied[m.version]; ok {
+			continue
+		}
+
+		log.Printf("Applying migration %d: %s", m.version, m.description)
+		err := runMigration(db, m, m.up, "INSERT INTO schema_migrations (version, description, applied_at) VALUES ($1, $2, $3)",
+			m.version, m.description, time.Now().UTC())
+		if err != nil {
+			return fmt.Errorf("migration %d: %w", m.version, err)
+		}
+	}
+	return nil
+}
+
+// migrateDown rolls back every applied migration newer than target, newest
+// first.
+func migrateDown(db *storage, target int) error {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return err
+	}
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if m.version <= target {
+			break
+		}
+		if _, ok := applied[m.version]; !ok {
+			continue
+		}
+
+		log.Printf("Rolling back migration %d: %s", m.version, m.description)
+		err := runMigration(db, m, m.down, "DELETE FROM schema_migrations WHERE version = $1", m.version)
+		if err != nil {
+			return fmt.Errorf("migration %d: %w", m.version, err)
+		}
+	}
+	return nil
+}
+
+func runMigration(db *storage, m migration, schema string, record string, args ...interface{}) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if m.only == nil || m.only == db.dialect {
+		if _, err := tx.Exec(db.dialect.schema(schema)); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if _, err := tx.Exec(db.dialect.rebind(record), args...); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// runMigrateCommand handles `vpbot migrate [up [version] | down [version] | status]`,
+// down without a version only rolls back the newest migration.
+func runMigrateCommand(db *storage, args []string) {
+	initMigrations(db)
+
+	action := "up"
+	if len(args) > 0 {
+		action = args[0]
+	}
+
+	target := -1
+	if len(args) > 1 {
+		var err error
+		target, err = strconv.Atoi(args[1])
+		if err != nil {
+			log.Printf("Invalid migration version '%s'", args[1])
+			os.Exit(1)
+		}
+	}
+
+	var err error
+	switch action {
+	case "up":
+		if target < 0 {
+			target = latestMigrationVersion()
+		}
+		err = migrateUp(db, target)
+	case "down":
+		if target < 0 {
+			target = currentMigrationVersion(db) - 1
+		}
+		err = migrateDown(db, target)
+	case "status":
+		err = printMigrationStatus(db)
+	default:
+		log.Printf("Unknown migrate action '%s', use up, down or status", action)
+		os.Exit(1)
+	}
+
+	if err != nil {
+		log.Printf("Migrating failed: %s", err)
+		os.Exit(1)
+	}
+}
+
+func currentMigrationVersion(db *storage) int {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		log.Printf("Couldn't get applied migrations: %s", err)
+		return 0
+	}
+
+	current := 0
+	for version := range applied {
+		if version > current {
+			current = version
+		}
+	}
+	return current
+}
+
+func printMigrationStatus(db *storage) error {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		state := "pending"
+		if appliedAt, ok := applied[m.version]; ok {
+			state = "applied " + appliedAt.Format(time.RFC3339)
+		}
+		fmt.Printf("%4d  %-28s  %s\n", m.version, state, m.description)
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/go-co-op/gocron"
+)
+
+// module is a feature of VPBot that mods can turn on and off per guild.
+// Commands and stream handlers of disabled modules are skipped by the
+// router, event handlers, cron jobs and HTTP routes have to check
+// moduleEnabledByName themselves.
+type module struct {
+	name           string
+	description    string
+	defaultEnabled bool
+	// setup registers the module's commands, handlers, cron jobs and routes
+	setup func(m *module, db *storage, scheduler *gocron.Scheduler)
+
+	eventHandlers []interface{}
+}
+
+type messageStreamHandler struct {
+	// module is nil for handlers that are always on
+	module *module
+	handle func(discordSession, *discordgo.MessageCreate)
+}
+
+var moduleMap = make(map[string]*module)
+
+func registerModule(m *module, db *storage, scheduler *gocron.Scheduler) {
+	if _, ok := moduleMap[m.name]; ok {
+		log.Fatalf("Tried registering module '%s' twice!", m.name)
+	}
+
+	log.Printf("Setting up module %s", m.name)
+	moduleMap[m.name] = m
+	m.setup(m, db, scheduler)
+}
+
+func (m *module) addCommand(cmd *commandHandler) *commandHandler {
+	cmd.module = m
+	return addCommand(cmd)
+}
+
+func (m *module) addStreamHandler(handler func(discordSession, *discordgo.MessageCreate)) {
+	messageStreamHandlers = append(messageStreamHandlers, messageStreamHandler{m, handler})
+}
+
+// addEventHandler adds a Discord event handler, see addSessionHandler. Unlike
+// commands and stream handlers it has to check moduleEnabledByName itself.
+func (m *module) addEventHandler(handler interface{}) {
+	m.eventHandlers = append(m.eventHandlers, handler)
+}
+
+// addModuleEventHandlers adds the event handlers of every module to the
+// Discord connection.
+func addModuleEventHandlers(d *discordgo.Session) {
+	for _, m := range sortedModules() {
+		for _, h := range m.eventHandlers {
+			addSessionHandler(d, h)
+		}
+	}
+}
+
+// handleHTTP adds a route to the HTTP server, it has to check
+// moduleEnabledByName itself for every guild it affects.
+func (m *module) handleHTTP(pattern string, handler http.HandlerFunc) {
+	http.HandleFunc(pattern, handler)
+}
+
+func moduleConfigKey(m *module) string {
+	return "module." + m.name + ".enabled"
+}
+
+// moduleEnabled reports whether m is on in the guild, modules can't be
+// toggled in DMs so they use the default there.
+func moduleEnabled(guildID string, m *module) bool {
+	if m == nil {
+		return true
+	}
+
+	enabled, err := strconv.ParseBool(guildConfigGet(guildID, moduleConfigKey(m)))
+	if err != nil {
+		return m.defaultEnabled
+	}
+	return enabled
+}
+
+// moduleEnabledByName is moduleEnabled for code that doesn't hold the module.
+func moduleEnabledByName(guildID string, name string) bool {
+	m, ok := moduleMap[name]
+	return ok && moduleEnabled(guildID, m)
+}
+
+// commandModule returns the module cmd belongs to, subcommands belong to the
+// module of their group.
+func commandModule(cmd *commandHandler) *module {
+	for c := cmd; c != nil; c = c.parent {
+		if c.module != nil {
+			return c.module
+		}
+	}
+	return nil
+}
+
+func sortedModules() []*module {
+	result := make([]*module, 0, len(moduleMap))
+	for _, m := range moduleMap {
+		result = append(result, m)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].name < result[j].name })
+	return result
+}
+
+func moduleListHandler(ctx *commandContext) {
+	var sb strings.Builder
+	for _, m := range sortedModules() {
+		state := "off"
+		if moduleEnabled(ctx.guildID, m) {
+			state = "on"
+		}
+		sb.WriteString(fmt.Sprintf("`%s` **%s** %s\n", m.name, state, m.description))
+	}
+
+	ctx.replyMessage(&discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{{
+		Title:       "VPBot modules",
+		Description: sb.String(),
+		Color:       helpEmbedColor,
+	}}})
+}
+
+func moduleEnableHandler(ctx *commandContext) {
+	setModuleEnabled(ctx, true)
+}
+
+func moduleDisableHandler(ctx *commandContext) {
+	setModuleEnabled(ctx, false)
+}
+
+func setModuleEnabled(ctx *commandContext, enabled bool) {
+	m, ok := moduleMap[strings.ToLower(ctx.args.text("module"))]
+	if !ok {
+		ctx.reply(fmt.Sprintf("There is no module called `%s`, see `%smodule list`", ctx.args.text("module"), ctx.prefix()))
+		return
+	}
+
+	if err := guildConfigSet(ctx.guildID, moduleConfigKey(m), strconv.FormatBool(enabled)); err != nil {
+		log.Printf("Error trying to toggle module %s for guild %s: %s", m.name, ctx.guildID, err)
+		ctx.reply("Couldn't change the module, try again later")
+		return
+	}
+
+	// Slash commands of disabled modules aren't registered
+	go registerSlashCommands(ctx.session, ctx.guildID)
+
+	state := "disabled"
+	if enabled {
+		state = "enabled"
+	}
+	auditCommand(ctx, auditConfigChanged, "", fmt.Sprintf("The %s module %s", m.name, state))
+	ctx.reply(fmt.Sprintf("The %s module is now %s", m.name, state))
+}
+
+func moduleAutocomplete(_ *commandContext, focused *discordgo.ApplicationCommandInteractionDataOption) []*discordgo.ApplicationCommandOptionChoice {
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, 0)
+	for _, m := range sortedModules() {
+		if strings.HasPrefix(m.name, strings.ToLower(focused.StringValue())) {
+			choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: m.name, Value: m.name})
+		}
+	}
+	return choices
+}
@@ -9,33 +9,59 @@ import (
 	"regexp"
 	"strings"
 
-	"github.com/bwmarrin/discordgo"
+	"github.com/go-co-op/gocron"
 )
 
 var (
+	odinModule = &module{
+		name:        "odin",
+		description: "Let mods compile and run Odin code blocks, needs the odin compiler installed",
+		setup:       setupOdinModule,
+	}
+
 	odinPath      string
 	mainRegex     *regexp.Regexp
 	osImportRegex *regexp.Regexp
+
+	odinRunArgs = []commandArg{
+		{name: "code", description: "Odin code block to run", kind: argText, required: true},
+	}
 )
 
+func setupOdinModule(m *module, _ *storage, _ *gocron.Scheduler) {
+	initOdin()
+
+	m.addCommand(&commandHandler{
+		commandString: "odinrun",
+		description:   "Will compile an odin code block and run it",
+		modOnly:       true,
+		args:          odinRunArgs,
+		handleFunc:    odinRunHandle,
+	})
+}
+
 func initOdin() {
 	odinPath, _ = exec.LookPath("odin")
 	mainRegex = regexp.MustCompile(mainRegexStr)
 }
 
-func odinRunHandle(session *discordgo.Session, msg *discordgo.MessageCreate) {
-	mesg := strings.TrimPrefix(msg.Content, "!odinrun")
-	mesg = strings.TrimSpace(mesg)
+func odinRunHandle(ctx *commandContext) {
+	if len(odinPath) <= 0 {
+		ctx.reply("The odin compiler isn't installed where VPBot is running")
+		return
+	}
+
+	mesg := ctx.args.text("code")
 
 	i1 := strings.Index(mesg, "```")
 	if i1 < 0 {
-		session.ChannelMessageSend(msg.ChannelID, "Please put your code in a code block")
+		ctx.reply("Please put your code in a code block")
 		return
 	}
 	offset := i1 + 3
 	i2 := strings.Index(mesg[offset:], "```")
 	if i2 < 0 {
-		session.ChannelMessageSend(msg.ChannelID, "Incomplete code block")
+		ctx.reply("Incomplete code block")
 		return
 	}
 
@@ -46,13 +72,13 @@ func odinRunHandle(session *discordgo.Session, msg *discordgo.MessageCreate) {
 		code = strings.ReplaceAll(odinProgramTemplate, "REPLACE_ME", code)
 	}
 
-	session.ChannelMessageSend(msg.ChannelID, "Running code...")
+	ctx.reply("Running code...")
 
 	f, err := os.Create("test.odin")
 	defer os.Remove("test.odin")
 
 	if err != nil {
-		session.ChannelMessageSend(msg.ChannelID, "Couldn't create file to run!!")
+		ctx.reply("Couldn't create file to run!!")
 		return
 	}
 
@@ -73,7 +99,7 @@ func odinRunHandle(session *discordgo.Session, msg *discordgo.MessageCreate) {
 
 	resp := fmt.Sprintf("Output: ```\n%v\n```", out.String())
 
-	session.ChannelMessageSend(msg.ChannelID, resp)
+	ctx.reply(resp)
 }
 
 const mainRegexStr = `main\s::\sproc\(\)\s{(?:(?:.|\n)*)}`
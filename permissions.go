@@ -0,0 +1,365 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// allCommands is used in place of a command name for rules applying to
+// every command
+const allCommands = "*"
+
+const (
+	permTargetUser       = "user"
+	permTargetRole       = "role"
+	permTargetChannel    = "channel"
+	permTargetPermission = "permission"
+)
+
+// permTargetPrecedence is the order rules are considered in, the first kind
+// of target with a matching rule decides
+var permTargetPrecedence = []string{permTargetUser, permTargetRole, permTargetChannel, permTargetPermission}
+
+var permissionNames = map[string]int64{
+	"administrator":    discordgo.PermissionAdministrator,
+	"manage_server":    discordgo.PermissionManageServer,
+	"manage_channels":  discordgo.PermissionManageChannels,
+	"manage_roles":     discordgo.PermissionManageRoles,
+	"manage_messages":  discordgo.PermissionManageMessages,
+	"manage_threads":   discordgo.PermissionManageThreads,
+	"kick_members":     discordgo.PermissionKickMembers,
+	"ban_members":      discordgo.PermissionBanMembers,
+	"moderate_members": discordgo.PermissionModerateMembers,
+	"view_audit_log":   discordgo.PermissionViewAuditLogs,
+}
+
+type commandPermission struct {
+	id         int
+	guildID    string
+	command    string
+	targetType string
+	targetID   string
+	allow      bool
+}
+
+var (
+	queryCommandPermissions *sql.Stmt
+	insertCommandPermission *sql.Stmt
+	deleteCommandPermission *sql.Stmt
+
+	commandPermissionMutex sync.RWMutex
+	// commandPermissionCache holds the rules of every guild looked up so far
+	commandPermissionCache = make(map[string][]commandPermission)
+)
+
+func initCommandPermissions(db *storage) {
+	queryCommandPermissions = dbPrepare(db,
+		"SELECT id, command, target_type, target_id, allow FROM command_permission WHERE guild_id = $1 ORDER BY id")
+	insertCommandPermission = dbPrepare(db,
+		"INSERT INTO command_permission (guild_id, command, target_type, target_id, allow) VALUES ($1, $2, $3, $4, $5)")
+	deleteCommandPermission = dbPrepare(db, "DELETE FROM command_permission WHERE id = $1 AND guild_id = $2")
+}
+
+func guildCommandPermissions(guildID string) []commandPermission {
+	commandPermissionMutex.RLock()
+	perms, ok := commandPermissionCache[guildID]
+	commandPermissionMutex.RUnlock()
+	if ok {
+		return perms
+	}
+
+	rows, err := queryCommandPermissions.Query(guildID)
+	if err != nil {
+		// Don't cache, so we try again next time
+		log.Printf("Error trying to get command permissions for guild %s: %s", guildID, err)
+		return nil
+	}
+	defer rows.Close()
+
+	perms = make([]commandPermission, 0)
+	for rows.Next() {
+		p := commandPermission{guildID: guildID}
+		if err := rows.Scan(&p.id, &p.command, &p.targetType, &p.targetID, &p.allow); err != nil {
+			log.Printf("Error trying to read command permission: %s", err)
+			continue
+		}
+		perms = append(perms, p)
+	}
+
+	commandPermissionMutex.Lock()
+	commandPermissionCache[guildID] = perms
+	commandPermissionMutex.Unlock()
+
+	return perms
+}
+
+func forgetCommandPermissions(guildID string) {
+	commandPermissionMutex.Lock()
+	delete(commandPermissionCache, guildID)
+	commandPermissionMutex.Unlock()
+}
+
+// commandAllowed decides whether the user may run cmd in the channel.
+//
+// Administrators can always run everything so they can't lock themselves
+// out. Otherwise rules for the command itself beat rules for its groups,
+// which beat rules for all commands. Within those, user rules beat role
+// rules, which beat channel and then permission rules, and deny beats allow.
+// Without any matching rules mod only commands fall back to the Mod role check.
+func commandAllowed(s discordSession, guildID string, channelID string, userID string, cmd *commandHandler) bool {
+	return newCommandAccess(s, guildID, channelID, userID).allows(cmd)
+}
+
+// commandAccess holds what commandAllowed needs to know about a user, so
+// checking many commands at once, like help does, only looks them up once.
+type commandAccess struct {
+	session   discordSession
+	guildID   string
+	channelID string
+	userID    string
+	perm      int64
+	// roles are only looked up once a rule or mod only command needs them
+	roles       []string
+	rolesLoaded bool
+}
+
+func newCommandAccess(s discordSession, guildID string, channelID string, userID string) *commandAccess {
+	perm, _ := s.UserChannelPermissions(userID, channelID)
+	return &commandAccess{session: s, guildID: guildID, channelID: channelID, userID: userID, perm: perm}
+}
+
+func (a *commandAccess) memberRoles() []string {
+	if !a.rolesLoaded {
+		a.roles = memberRoles(a.session, a.guildID, a.userID)
+		a.rolesLoaded = true
+	}
+	return a.roles
+}
+
+func (a *commandAccess) allows(cmd *commandHandler) bool {
+	if a.perm&discordgo.PermissionAdministrator != 0 {
+		return true
+	}
+
+	if len(a.guildID) > 0 {
+		perms := guildCommandPermissions(a.guildID)
+		if len(perms) > 0 {
+			for _, name := range commandPermissionScopes(cmd) {
+				if allow, ok := matchCommandPermissions(perms, name, a.userID, a.channelID, a.memberRoles(), a.perm); ok {
+					return allow
+				}
+			}
+		}
+	}
+
+	if cmd.modOnly {
+		return hasModRole(a.session, a.guildID, a.memberRoles())
+	}
+	return true
+}
+
+// commandPermissionScopes lists the names rules can be stored under for cmd,
+// from most to least specific.
+func commandPermissionScopes(cmd *commandHandler) []string {
+	result := make([]string, 0)
+	for c := cmd; c != nil; c = c.parent {
+		result = append(result, c.fullName())
+	}
+	return append(result, allCommands)
+}
+
+func matchCommandPermissions(perms []commandPermission, command string, userID string, channelID string, roles []string, perm int64) (allow bool, matched bool) {
+	for _, targetType := range permTargetPrecedence {
+		for _, p := range perms {
+			if p.command != command || p.targetType != targetType {
+				continue
+			}
+
+			if commandPermissionMatches(p, userID, channelID, roles, perm) == false {
+				continue
+			}
+
+			if matched == false {
+				allow = true
+			}
+			matched = true
+			allow = allow && p.allow
+		}
+
+		if matched {
+			return allow, true
+		}
+	}
+
+	return false, false
+}
+
+func commandPermissionMatches(p commandPermission, userID string, channelID string, roles []string, perm int64) bool {
+	switch p.targetType {
+	case permTargetUser:
+		return p.targetID == userID
+	case permTargetChannel:
+		return p.targetID == channelID
+	case permTargetRole:
+		for _, r := range roles {
+			if r == p.targetID {
+				return true
+			}
+		}
+	case permTargetPermission:
+		bit, _ := strconv.ParseInt(p.targetID, 10, 64)
+		return bit != 0 && perm&bit == bit
+	}
+	return false
+}
+
+func memberRoles(s discordSession, guildID string, userID string) []string {
+	member, err := s.state().Member(guildID, userID)
+	if err != nil {
+		member, err = s.GuildMember(guildID, userID)
+	}
+	if err != nil || member == nil {
+		return nil
+	}
+	return member.Roles
+}
+
+// parsePermTarget works out what a rule target is, from a user, role or
+// channel mention, a raw ID or a permission name like manage_messages.
+func parsePermTarget(s discordSession, guildID string, target string) (targetType string, targetID string, err error) {
+	if bit, ok := permissionNames[strings.ToLower(target)]; ok {
+		return permTargetPermission, strconv.FormatInt(bit, 10), nil
+	}
+
+	if id := mentionID(roleMentionRegex, target); id != "" {
+		if _, err := s.state().Role(guildID, id); err == nil {
+			return permTargetRole, id, nil
+		}
+	}
+
+	if id := mentionID(channelMentionRegex, target); id != "" {
+		if _, err := s.state().Channel(id); err == nil {
+			return permTargetChannel, id, nil
+		}
+	}
+
+	if id := mentionID(userMentionRegex, target); id != "" {
+		return permTargetUser, id, nil
+	}
+
+	names := make([]string, 0, len(permissionNames))
+	for name := range permissionNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return "", "", fmt.Errorf("`%s` isn't a user, role, channel or one of these permissions: %s", target, strings.Join(names, ", "))
+}
+
+func describePermTarget(p commandPermission) string {
+	switch p.targetType {
+	case permTargetUser:
+		return "<@" + p.targetID + ">"
+	case permTargetRole:
+		return "<@&" + p.targetID + ">"
+	case permTargetChannel:
+		return "<#" + p.targetID + ">"
+	case permTargetPermission:
+		bit, _ := strconv.ParseInt(p.targetID, 10, 64)
+		for name, b := range permissionNames {
+			if b == bit {
+				return "`" + name + "`"
+			}
+		}
+	}
+	return p.targetID
+}
+
+func permAllowHandler(ctx *commandContext) {
+	addCommandPermission(ctx, true)
+}
+
+func permDenyHandler(ctx *commandContext) {
+	addCommandPermission(ctx, false)
+}
+
+func addCommandPermission(ctx *commandContext, allow bool) {
+	name := strings.ToLower(strings.TrimPrefix(ctx.args.text("command"), ctx.prefix()))
+	if name != allCommands {
+		cmd, ok := findCommand(name)
+		if !ok {
+			ctx.reply(fmt.Sprintf("There is no command called `%s`", name))
+			return
+		}
+		name = cmd.fullName()
+	}
+
+	targetType, targetID, err := parsePermTarget(ctx.session, ctx.guildID, ctx.args.text("target"))
+	if err != nil {
+		ctx.reply(err.Error())
+		return
+	}
+
+	_, err = insertCommandPermission.Exec(ctx.guildID, name, targetType, targetID, allow)
+	if err != nil {
+		log.Printf("Error trying to add command permission: %s", err)
+		ctx.reply("Couldn't save the permission, try again later")
+		return
+	}
+	forgetCommandPermissions(ctx.guildID)
+
+	verb := "Denied"
+	if allow {
+		verb = "Allowed"
+	}
+	reply := fmt.Sprintf("%s `%s` for %s", verb, name, describePermTarget(commandPermission{targetType: targetType, targetID: targetID}))
+	auditCommand(ctx, auditConfigChanged, "", reply)
+	ctx.reply(reply)
+}
+
+func permListHandler(ctx *commandContext) {
+	filter := strings.ToLower(strings.TrimPrefix(ctx.args.text("command"), ctx.prefix()))
+
+	var sb strings.Builder
+	for _, p := range guildCommandPermissions(ctx.guildID) {
+		if len(filter) > 0 && p.command != filter {
+			continue
+		}
+
+		verb := "deny"
+		if p.allow {
+			verb = "allow"
+		}
+		sb.WriteString(fmt.Sprintf("`%d` %s `%s` for %s\n", p.id, verb, p.command, describePermTarget(p)))
+	}
+
+	if sb.Len() <= 0 {
+		ctx.reply("There are no command permissions, mod only commands are available to administrators and the Mod role")
+		return
+	}
+	ctx.reply(sb.String())
+}
+
+func permRemoveHandler(ctx *commandContext) {
+	id := ctx.args.integer("id")
+	res, err := deleteCommandPermission.Exec(id, ctx.guildID)
+	if err != nil {
+		log.Printf("Error trying to remove command permission %d: %s", id, err)
+		ctx.reply("Couldn't remove the permission, try again later")
+		return
+	}
+	forgetCommandPermissions(ctx.guildID)
+
+	if n, _ := res.RowsAffected(); n <= 0 {
+		ctx.reply(fmt.Sprintf("There is no command permission with ID %d", id))
+		return
+	}
+	auditCommand(ctx, auditConfigChanged, "", fmt.Sprintf("Removed command permission %d", id))
+	ctx.reply(fmt.Sprintf("Removed command permission %d", id))
+}
@@ -1,52 +1,670 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
-	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
 	"github.com/bwmarrin/discordgo"
+	"github.com/go-co-op/gocron"
 )
 
+const policeModuleName = "police"
+
+var policeModule = &module{
+	name:           policeModuleName,
+	description:    "Delete or flag messages breaking the rules of showcase channels",
+	defaultEnabled: true,
+	setup:          setupPoliceModule,
+}
+
 const urlRegexString string = `(?:(?:https?|ftp):\/\/|\b(?:[a-z\d]+\.))(?:(?:[^\s()<>]+|\((?:[^\s()<>]+|(?:\([^\s()<>]+\)))?\))+(?:\((?:[^\s()<>]+|(?:\(?:[^\s()<>]+\)))?\)|[^\s!()\[\]{};:'".,<>?«»“”‘’]))?`
 
+// linkRegex only finds links with a scheme and a top level domain, unlike
+// urlRegex which also takes prose like "node.js" for a link. Domain rules use
+// it so they don't act on words.
+var linkRegex = regexp.MustCompile(`(?i)\bhttps?://((?:[a-z\d](?:[a-z\d-]*[a-z\d])?\.)+[a-z]{2,})(?::\d+)?(?:[/?#][^\s<>]*)?`)
+
+// What happens to messages breaking a rule, they're logged either way
+const (
+	policeActionDelete = "delete"
+	// policeActionWarn DMs the author but keeps the message
+	policeActionWarn = "warn"
+	// policeActionLog only reports the message in the mod channel
+	policeActionLog = "log"
+)
+
+var policeActions = []string{policeActionDelete, policeActionWarn, policeActionLog}
+
+const (
+	policeRuleLinkOrFile     = "link-or-file"
+	policeRuleFileTypes      = "file-types"
+	policeRuleAllowedDomains = "allowed-domains"
+	policeRuleBlockedDomains = "blocked-domains"
+	policeRuleMinLength      = "min-length"
+	policeRuleMaxPosts       = "max-posts"
+	policeRuleThreadReplies  = "thread-replies"
+)
+
+const (
+	// policePostPeriod is the period max-posts rules count posts in
+	policePostPeriod = 24 * time.Hour
+	// policeMessageLimit is the most Discord allows in a message without Nitro
+	policeMessageLimit = 2000
+)
+
+type policeRuleKind struct {
+	name        string
+	description string
+	// parse checks and normalizes the value of a new rule
+	parse func(value string) (string, error)
+	// defaultMessage is sent to authors when the rule has no message of its own
+	defaultMessage func(value string) string
+	// broken reports whether the message breaks the rule, messages in threads
+	// are only checked by thread-replies rules
+	broken func(msg *discordgo.Message, channelID string, value string) bool
+	// fixable rules can be fixed by editing the message or posting what's
+	// missing, deleting waits for the grace period for those
+	fixable bool
+}
+
+var policeRuleKinds = []policeRuleKind{
+	{
+		name:        policeRuleLinkOrFile,
+		description: "Messages need a link, file or embed",
+		parse:       parseNoValue,
+		defaultMessage: func(string) string {
+			return "Showcase messages require that either you include a link or a picture/file in your message, if you believe your message has been wrongfully deleted, please contact a mod.\n If you wish to chat about showcase, please look for a #showcase-banter channel"
+		},
+		broken: func(msg *discordgo.Message, _ string, _ string) bool {
+			return len(msg.Attachments) <= 0 && len(msg.Embeds) <= 0 && urlRegex.MatchString(msg.Content) == false
+		},
+		fixable: true,
+	},
+	{
+		name:        policeRuleFileTypes,
+		description: "Messages need a file of one of the types, like image, video or pdf",
+		parse:       parseList,
+		defaultMessage: func(value string) string {
+			return fmt.Sprintf("Messages here need a file of one of these types: %s", value)
+		},
+		broken: func(msg *discordgo.Message, _ string, value string) bool {
+			for _, a := range msg.Attachments {
+				if attachmentOfType(a, splitList(value)) {
+					return false
+				}
+			}
+			return true
+		},
+		fixable: true,
+	},
+	{
+		name:        policeRuleAllowedDomains,
+		description: "Links can only go to the domains, or their subdomains",
+		parse:       parseList,
+		defaultMessage: func(value string) string {
+			return fmt.Sprintf("Links here can only go to %s", value)
+		},
+		broken: func(msg *discordgo.Message, _ string, value string) bool {
+			for _, host := range linkHosts(msg.Content) {
+				if !hostInDomains(host, splitList(value)) {
+					return true
+				}
+			}
+			return false
+		},
+		fixable: true,
+	},
+	{
+		name:        policeRuleBlockedDomains,
+		description: "Links can't go to the domains, or their subdomains",
+		parse:       parseList,
+		defaultMessage: func(value string) string {
+			return fmt.Sprintf("Links to %s aren't allowed here", value)
+		},
+		broken: func(msg *discordgo.Message, _ string, value string) bool {
+			for _, host := range linkHosts(msg.Content) {
+				if hostInDomains(host, splitList(value)) {
+					return true
+				}
+			}
+			return false
+		},
+		fixable: true,
+	},
+	{
+		name:        policeRuleMinLength,
+		description: "Messages need a description of at least this many characters, links don't count",
+		parse:       parsePositiveInt,
+		defaultMessage: func(value string) string {
+			return fmt.Sprintf("Messages here need a description of at least %s characters, tell people what you're showing", value)
+		},
+		broken: func(msg *discordgo.Message, _ string, value string) bool {
+			min, _ := strconv.Atoi(value)
+			description := strings.TrimSpace(urlRegex.ReplaceAllString(msg.Content, ""))
+			return utf8.RuneCountInString(description) < min
+		},
+		fixable: true,
+	},
+	{
+		name:        policeRuleMaxPosts,
+		description: "People can post at most this many messages a day",
+		parse:       parsePositiveInt,
+		defaultMessage: func(value string) string {
+			return fmt.Sprintf("You can post at most %s messages here a day, try again tomorrow", value)
+		},
+		broken: func(msg *discordgo.Message, channelID string, value string) bool {
+			max, _ := strconv.Atoi(value)
+			count, err := policeRules.countPosts(channelID, msg.Author.ID, time.Now().Add(-policePostPeriod))
+			if err != nil {
+				log.Printf("Error trying to count the posts of %s in %s: %s", msg.Author.ID, channelID, err)
+				return false
+			}
+			return count >= max
+		},
+	},
+	{
+		name:        policeRuleThreadReplies,
+		description: "Whether people can reply in threads, allow or deny, they can unless denied",
+		parse: func(value string) (string, error) {
+			value = strings.ToLower(strings.TrimSpace(value))
+			if value != "allow" && value != "deny" {
+				return "", errors.New("the value has to be allow or deny")
+			}
+			return value, nil
+		},
+		defaultMessage: func(string) string {
+			return "Replies in threads aren't allowed here"
+		},
+		broken: func(msg *discordgo.Message, channelID string, value string) bool {
+			return value == "deny" && msg.ChannelID != channelID
+		},
+	},
+}
+
 var (
-	policeChannel *discordgo.Channel
+	policeRuleMutex sync.RWMutex
+	// policeRuleCache holds the rules of every guild looked up so far
+	policeRuleCache = make(map[string][]policeRule)
 )
 
-func initPoliceChannel(s *discordgo.Session) {
-	channelId := os.Getenv("VPBOT_POLICE_CHANNEL")
+func setupPoliceModule(m *module, db *storage, scheduler *gocron.Scheduler) {
+	policeRules = newSQLPoliceRuleStore(db)
+
+	policeGroup := m.addCommand(&commandHandler{
+		commandString: "police",
+		description:   "Set the rules messages in showcase channels have to follow",
+		category:      "Moderation",
+		modOnly:       true,
+		guildOnly:     true,
+	})
+	policeIDArg := commandArg{name: "id", description: "ID of the rule, the IDs are shown by police list", kind: argInt, required: true}
+	addSubcommand(policeGroup, &commandHandler{
+		commandString: "add",
+		description:   "Add a rule to a channel, see police rules for what rules there are",
+		args: []commandArg{
+			{name: "channel", description: "Channel the rule applies to", kind: argChannel, required: true},
+			{name: "rule", description: "What the rule checks, eg. min-length", kind: argString, required: true, autocomplete: true},
+			{name: "action", description: "delete, warn or log", kind: argString, required: true, autocomplete: true},
+			{name: "value", description: "Depends on the rule, eg. a number or a list of domains", kind: argText},
+		},
+		autocomplete: policeRuleAutocomplete,
+		handleFunc:   policeAddHandler,
+	})
+	addSubcommand(policeGroup, &commandHandler{
+		commandString: "list",
+		description:   "List the rules of this server",
+		aliases:       []string{"ls"},
+		args: []commandArg{
+			{name: "channel", description: "Only list the rules of this channel", kind: argChannel},
+		},
+		handleFunc: policeListHandler,
+	})
+	addSubcommand(policeGroup, &commandHandler{
+		commandString: "rules",
+		description:   "Explain the kinds of rules that can be added",
+		handleFunc:    policeRulesHandler,
+	})
+	addSubcommand(policeGroup, &commandHandler{
+		commandString: "message",
+		description:   "Change the DM sent to people breaking a rule, leave it out to go back to the default",
+		args: []commandArg{
+			policeIDArg,
+			{name: "message", description: "The new DM", kind: argText},
+		},
+		handleFunc: policeMessageHandler,
+	})
+	addSubcommand(policeGroup, &commandHandler{
+		commandString: "remove",
+		description:   "Remove a rule by its ID",
+		aliases:       []string{"rm", "delete"},
+		args:          []commandArg{policeIDArg},
+		handleFunc:    policeRemoveHandler,
+	})
+
+	m.addStreamHandler(msgStreamPoliceHandler)
+	m.addEventHandler(policeMessageUpdate)
+
+	_, err := scheduler.Every(1).Day().At("04:00").Do(prunePolicePosts)
+	if err != nil {
+		log.Panic(err)
+	}
+}
 
-	if(len(channelId) <= 0) {
+func msgStreamPoliceHandler(session discordSession, msg *discordgo.MessageCreate) {
+	if len(msg.GuildID) <= 0 {
 		return
 	}
 
-	var err error
-	policeChannel, err = s.Channel(channelId)
+	// Replies in threads are policed by the rules of the channel they're in
+	channelID := msg.ChannelID
+	channel, err := session.state().Channel(msg.ChannelID)
+	if err == nil && channel.IsThread() {
+		channelID = channel.ParentID
+	}
 
-	if err != nil {
-		log.Printf("Couldn't find the police with ID: %s", channelId)
+	rules := channelPoliceRules(msg.GuildID, channelID)
+	if len(rules) <= 0 {
 		return
 	}
+	// The follow up is checked as part of the message it completes, on its
+	// own a screenshot would break a min-length rule
+	if policeFollowUp(msg.Message) {
+		return
+	}
+
+	grace := policeGracePeriod(msg.GuildID)
+	waiting := make([]policeRule, 0)
+	countPosts := false
+	for _, r := range rules {
+		kind, ok := findPoliceRuleKind(r.kind)
+		if !ok {
+			continue
+		}
+		if r.kind == policeRuleMaxPosts {
+			countPosts = true
+		}
+		if msg.ChannelID != channelID && r.kind != policeRuleThreadReplies {
+			continue
+		}
+
+		if kind.broken(msg.Message, channelID, r.value) {
+			if r.action == policeActionDelete && kind.fixable && grace > 0 {
+				waiting = append(waiting, r)
+				continue
+			}
+			enforcePoliceRule(session, msg.Message, r, kind)
+			if r.action == policeActionDelete {
+				return
+			}
+		}
+	}
+
+	if len(waiting) > 0 {
+		waitForPoliceFix(session, msg.Message, waiting, grace)
+	}
+	if countPosts && msg.ChannelID == channelID {
+		if err := policeRules.addPost(channelID, msg.Author.ID, time.Now()); err != nil {
+			log.Printf("Error trying to count the post of %s in %s: %s", msg.Author.ID, channelID, err)
+		}
+	}
 }
 
-func msgStreamPoliceHandler(session *discordgo.Session, msg *discordgo.MessageCreate) {
-	if policeChannel != nil && msg.ChannelID == policeChannel.ID {
-		urlInMessage := urlRegex.MatchString(msg.Content)
+// channelPoliceRules returns the rules of the channel. The police channel set
+// with !config gets the link-or-file rule if it has no rules of its own, as
+// that was the only rule before they could be changed.
+func channelPoliceRules(guildID string, channelID string) []policeRule {
+	result := make([]policeRule, 0)
+	for _, r := range guildPoliceRules(guildID) {
+		if r.channelID == channelID {
+			result = append(result, r)
+		}
+	}
+
+	if len(result) <= 0 && channelID == guildConfigGet(guildID, configPoliceChannel) {
+		result = append(result, policeRule{guildID: guildID, channelID: channelID, kind: policeRuleLinkOrFile, action: policeActionDelete})
+	}
+	return result
+}
 
-		if len(msg.Attachments) <= 0 && len(msg.Embeds) <= 0 && urlInMessage == false {
-			guild, _ := session.State.Guild(msg.GuildID)
-			channel, _ := session.State.Channel(msg.ChannelID)
-			log.Printf("[%s|%s] Message did not furfill requirements! deleting message (%s) from %s#%s\n%s", guild.Name, channel.Name, msg.ID, msg.Author.Username, msg.Author.Discriminator, msg.Content)
-			session.ChannelMessageDelete(channel.ID, msg.ID)
-			sendPoliceDM(session, msg.Author, guild, channel, "Message was deleted", "Showcase messages require that either you include a link or a picture/file in your message, if you believe your message has been wrongfully deleted, please contact a mod.\n If you wish to chat about showcase, please look for a #showcase-banter channel")
+func guildPoliceRules(guildID string) []policeRule {
+	policeRuleMutex.RLock()
+	rules, ok := policeRuleCache[guildID]
+	policeRuleMutex.RUnlock()
+	if ok {
+		return rules
+	}
+
+	rules, err := policeRules.list(guildID)
+	if err != nil {
+		// Don't cache, so we try again next time
+		log.Printf("Error trying to get police rules for guild %s: %s", guildID, err)
+		return nil
+	}
+
+	policeRuleMutex.Lock()
+	policeRuleCache[guildID] = rules
+	policeRuleMutex.Unlock()
+
+	return rules
+}
+
+func forgetPoliceRules(guildID string) {
+	policeRuleMutex.Lock()
+	delete(policeRuleCache, guildID)
+	policeRuleMutex.Unlock()
+}
+
+// enforcePoliceRule takes the rule's action on a message breaking it.
+func enforcePoliceRule(session discordSession, msg *discordgo.Message, r policeRule, kind policeRuleKind) {
+	guild, err := session.state().Guild(msg.GuildID)
+	if err != nil {
+		guild = &discordgo.Guild{ID: msg.GuildID}
+	}
+	channel, err := session.state().Channel(msg.ChannelID)
+	if err != nil {
+		channel = &discordgo.Channel{ID: msg.ChannelID}
+	}
+
+	reason := r.message
+	if len(reason) <= 0 {
+		reason = kind.defaultMessage(r.value)
+	}
+
+	log.Printf("[%s|%s] Message (%s) from %s#%s broke the %s rule, action %s\n%s", guild.Name, channel.Name, msg.ID, msg.Author.Username, msg.Author.Discriminator, r.kind, r.action, msg.Content)
+	audit := auditEntry{
+		guildID:   msg.GuildID,
+		targetID:  msg.Author.ID,
+		channelID: msg.ChannelID,
+		details:   fmt.Sprintf("Broke the %s rule, the message was:\n%s", r.kind, msg.Content),
+	}
+	switch r.action {
+	case policeActionDelete:
+		if err := session.ChannelMessageDelete(channel.ID, msg.ID); err != nil {
+			log.Printf("Couldn't delete message %s: %s", msg.ID, err)
+			return
+		}
+		audit.action = auditMessageDeleted
+		sendPoliceDM(session, msg.Author, guild, channel, "Message was deleted", reason, msg.Content)
+	case policeActionWarn:
+		audit.action = auditMessageWarned
+		sendPoliceDM(session, msg.Author, guild, channel, "Message breaks the rules", reason, "")
+	case policeActionLog:
+		audit.action = auditMessageFlagged
+		modChannelID := guildConfigGet(msg.GuildID, configModChannel)
+		if len(modChannelID) > 0 {
+			session.ChannelMessageSend(modChannelID, fmt.Sprintf("<@%s> broke the %s rule in <#%s>: https://discord.com/channels/%s/%s/%s",
+				msg.Author.ID, r.kind, channel.ID, msg.GuildID, msg.ChannelID, msg.ID))
 		}
 	}
+	auditAutomatic(session, audit)
 }
 
-func sendPoliceDM(s *discordgo.Session, user *discordgo.User, guild *discordgo.Guild, channel *discordgo.Channel, event string, reason string) {
+// sendPoliceDM tells the user what happened to their message, original is
+// what they wrote so they don't lose it, sent on its own so it's easy to copy.
+func sendPoliceDM(s discordSession, user *discordgo.User, guild *discordgo.Guild, channel *discordgo.Channel, event string, reason string, original string) {
 	dm, err := s.UserChannelCreate(user.ID)
-	if err == nil {
-		s.ChannelMessageSend(dm.ID, fmt.Sprintf("%s in '%s' channel '%s', reason:\n%s", event, guild.Name, channel.Name, reason))
+	if err != nil {
+		return
+	}
+
+	content := fmt.Sprintf("%s in '%s' channel '%s', reason:\n%s", event, guild.Name, channel.Name, reason)
+	if len(strings.TrimSpace(original)) <= 0 {
+		s.ChannelMessageSend(dm.ID, content)
+		return
+	}
+
+	s.ChannelMessageSend(dm.ID, content+"\n\nHere's what you wrote, so you can post it again:")
+	s.ChannelMessageSend(dm.ID, truncate(original, policeMessageLimit))
+}
+
+func prunePolicePosts() {
+	if err := policeRules.prunePosts(time.Now().Add(-policePostPeriod)); err != nil {
+		log.Printf("Error trying to prune police posts: %s", err)
+	}
+}
+
+func findPoliceRuleKind(name string) (policeRuleKind, bool) {
+	for _, k := range policeRuleKinds {
+		if k.name == strings.ToLower(name) {
+			return k, true
+		}
+	}
+	return policeRuleKind{}, false
+}
+
+func parseNoValue(value string) (string, error) {
+	if len(strings.TrimSpace(value)) > 0 {
+		return "", errors.New("the rule doesn't take a value")
+	}
+	return "", nil
+}
+
+func parsePositiveInt(value string) (string, error) {
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || n <= 0 {
+		return "", errors.New("the value has to be a number above 0")
+	}
+	return strconv.Itoa(n), nil
+}
+
+// parseList takes a list separated by commas or spaces, it's stored
+// lowercased and separated by ", ". Leading dots are dropped, so .png and
+// png are the same.
+func parseList(value string) (string, error) {
+	items := splitList(value)
+	if len(items) <= 0 {
+		return "", errors.New("the value has to be a list, like `png, gif`")
+	}
+	return strings.Join(items, ", "), nil
+}
+
+func splitList(value string) []string {
+	items := strings.FieldsFunc(strings.ToLower(value), func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+	for n := range items {
+		items[n] = strings.TrimPrefix(items[n], ".")
+	}
+	return items
+}
+
+// attachmentOfType matches a file against types like image, which matches
+// the content type, or png and .png, which match the file extension.
+func attachmentOfType(a *discordgo.MessageAttachment, types []string) bool {
+	contentType := strings.ToLower(a.ContentType)
+	ext := strings.TrimPrefix(strings.ToLower(path.Ext(a.Filename)), ".")
+	for _, t := range types {
+		if t == ext || t == contentType || strings.HasPrefix(contentType, t+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// linkHosts returns the hosts of the links in the text.
+func linkHosts(text string) []string {
+	result := make([]string, 0)
+	for _, match := range linkRegex.FindAllStringSubmatch(text, -1) {
+		result = append(result, strings.ToLower(match[1]))
 	}
-}
\ No newline at end of file
+	return result
+}
+
+func hostInDomains(host string, domains []string) bool {
+	for _, d := range domains {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+func policeAddHandler(ctx *commandContext) {
+	channel := ctx.args.channel("channel")
+	if channel.GuildID != ctx.guildID {
+		ctx.reply("The channel has to be in this server")
+		return
+	}
+
+	kind, ok := findPoliceRuleKind(ctx.args.text("rule"))
+	if !ok {
+		ctx.reply(fmt.Sprintf("There is no rule called `%s`, see `%spolice rules`", ctx.args.text("rule"), ctx.prefix()))
+		return
+	}
+
+	action := strings.ToLower(ctx.args.text("action"))
+	if !validPoliceAction(action) {
+		ctx.reply(fmt.Sprintf("The action has to be one of %s", strings.Join(policeActions, ", ")))
+		return
+	}
+
+	value, err := kind.parse(ctx.args.text("value"))
+	if err != nil {
+		ctx.reply(fmt.Sprintf("Couldn't add the %s rule, %s", kind.name, err))
+		return
+	}
+
+	r := &policeRule{guildID: ctx.guildID, channelID: channel.ID, kind: kind.name, value: value, action: action}
+	if err := policeRules.add(r); err != nil {
+		log.Printf("Error trying to add police rule: %s", err)
+		ctx.reply("Couldn't save the rule, try again later")
+		return
+	}
+	forgetPoliceRules(ctx.guildID)
+
+	auditCommand(ctx, auditConfigChanged, "", fmt.Sprintf("Added police rule %d: %s", r.id, describePoliceRule(*r)))
+	ctx.reply(fmt.Sprintf("Added rule `%d`: %s", r.id, describePoliceRule(*r)))
+}
+
+func validPoliceAction(action string) bool {
+	for _, a := range policeActions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+func describePoliceRule(r policeRule) string {
+	rule := r.kind
+	if len(r.value) > 0 {
+		rule += " " + r.value
+	}
+	return fmt.Sprintf("%s in <#%s>, %s", rule, r.channelID, r.action)
+}
+
+func policeListHandler(ctx *commandContext) {
+	filter := ctx.args.channel("channel")
+
+	var sb strings.Builder
+	for _, r := range guildPoliceRules(ctx.guildID) {
+		if filter != nil && r.channelID != filter.ID {
+			continue
+		}
+
+		sb.WriteString(fmt.Sprintf("`%d` %s\n", r.id, describePoliceRule(r)))
+		if len(r.message) > 0 {
+			sb.WriteString(fmt.Sprintf("> %s\n", truncate(r.message, 100)))
+		}
+	}
+
+	if sb.Len() <= 0 {
+		policeChannelID := guildConfigGet(ctx.guildID, configPoliceChannel)
+		if len(policeChannelID) > 0 && (filter == nil || filter.ID == policeChannelID) {
+			ctx.reply(fmt.Sprintf("There are no rules, messages in <#%s> without a link or file are deleted", policeChannelID))
+			return
+		}
+		ctx.reply("There are no rules")
+		return
+	}
+	ctx.replyMessage(&discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{{
+		Title:       "Police rules",
+		Description: sb.String(),
+		Color:       helpEmbedColor,
+	}}})
+}
+
+func policeRulesHandler(ctx *commandContext) {
+	var sb strings.Builder
+	for _, k := range policeRuleKinds {
+		sb.WriteString(fmt.Sprintf("`%s` %s\n", k.name, k.description))
+	}
+	sb.WriteString(fmt.Sprintf("\nActions: `%s` the message and DM the author, `%s` the author by DM, or only `%s` it in the mod channel",
+		policeActionDelete, policeActionWarn, policeActionLog))
+	sb.WriteString(fmt.Sprintf("\nSet `%s` with `%sconfig set` to give people time to fix their messages before they're deleted",
+		configPoliceGracePeriod, ctx.prefix()))
+
+	ctx.replyMessage(&discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{{
+		Title:       "Police rules",
+		Description: sb.String(),
+		Color:       helpEmbedColor,
+		Footer:      &discordgo.MessageEmbedFooter{Text: fmt.Sprintf("Example: %spolice add #showcase min-length delete 20", ctx.prefix())},
+	}}})
+}
+
+func policeMessageHandler(ctx *commandContext) {
+	id := ctx.args.integer("id")
+	message := strings.TrimSpace(ctx.args.text("message"))
+	err := policeRules.setMessage(ctx.guildID, id, message)
+	if err == errNotFound {
+		ctx.reply(fmt.Sprintf("There is no rule with ID %d", id))
+		return
+	}
+	if err != nil {
+		log.Printf("Error trying to change the message of police rule %d: %s", id, err)
+		ctx.reply("Couldn't save the message, try again later")
+		return
+	}
+	forgetPoliceRules(ctx.guildID)
+	auditCommand(ctx, auditConfigChanged, "", fmt.Sprintf("Changed the message of police rule %d", id))
+
+	if len(message) <= 0 {
+		ctx.reply(fmt.Sprintf("Rule %d sends its default message again", id))
+		return
+	}
+	ctx.reply(fmt.Sprintf("Rule %d now sends:\n> %s", id, message))
+}
+
+func policeRemoveHandler(ctx *commandContext) {
+	id := ctx.args.integer("id")
+	err := policeRules.remove(ctx.guildID, id)
+	if err == errNotFound {
+		ctx.reply(fmt.Sprintf("There is no rule with ID %d", id))
+		return
+	}
+	if err != nil {
+		log.Printf("Error trying to remove police rule %d: %s", id, err)
+		ctx.reply("Couldn't remove the rule, try again later")
+		return
+	}
+	forgetPoliceRules(ctx.guildID)
+	auditCommand(ctx, auditConfigChanged, "", fmt.Sprintf("Removed police rule %d", id))
+
+	ctx.reply(fmt.Sprintf("Removed rule %d", id))
+}
+
+func policeRuleAutocomplete(_ *commandContext, focused *discordgo.ApplicationCommandInteractionDataOption) []*discordgo.ApplicationCommandOptionChoice {
+	names := policeActions
+	if focused.Name == "rule" {
+		names = make([]string, 0, len(policeRuleKinds))
+		for _, k := range policeRuleKinds {
+			names = append(names, k.name)
+		}
+	}
+
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, 0)
+	for _, name := range names {
+		if strings.Contains(name, strings.ToLower(focused.StringValue())) {
+			choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: name, Value: name})
+		}
+	}
+	return choices
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// pendingPoliceMessage is a message breaking rules that the author can still
+// fix, by editing it or posting what's missing right after. It's deleted
+// when the grace period is over unless they do.
+type pendingPoliceMessage struct {
+	session discordSession
+	msg     *discordgo.Message
+	rules   []policeRule
+	// followUps are the messages the author posted in the channel since
+	followUps []*discordgo.Message
+	timer     *time.Timer
+}
+
+var (
+	pendingPoliceMutex sync.Mutex
+	// pendingPoliceMessages are keyed by message ID, they only live in memory
+	// so messages pending during a restart are kept
+	pendingPoliceMessages = make(map[string]*pendingPoliceMessage)
+)
+
+// policeGracePeriod is how long the guild gives people to fix their
+// messages, zero if they're deleted right away.
+func policeGracePeriod(guildID string) time.Duration {
+	value := guildConfigGet(guildID, configPoliceGracePeriod)
+	if len(value) <= 0 {
+		return 0
+	}
+
+	grace, err := parseDuration(value)
+	if err != nil {
+		log.Printf("Invalid police grace period '%s' for guild %s: %s", value, guildID, err)
+		return 0
+	}
+	return grace
+}
+
+// waitForPoliceFix deletes the message after the grace period if it still
+// breaks any of the rules by then.
+func waitForPoliceFix(s discordSession, msg *discordgo.Message, rules []policeRule, grace time.Duration) {
+	log.Printf("Message (%s) from %s breaks %d rules, waiting %s for it to be fixed", msg.ID, msg.Author.String(), len(rules), grace)
+
+	p := &pendingPoliceMessage{session: s, msg: msg, rules: rules}
+	pendingPoliceMutex.Lock()
+	pendingPoliceMessages[msg.ID] = p
+	p.timer = time.AfterFunc(grace, func() { policeGraceOver(msg.ID) })
+	pendingPoliceMutex.Unlock()
+}
+
+func policeGraceOver(messageID string) {
+	pendingPoliceMutex.Lock()
+	p, ok := pendingPoliceMessages[messageID]
+	if !ok {
+		pendingPoliceMutex.Unlock()
+		return
+	}
+	delete(pendingPoliceMessages, messageID)
+	r, kind, broken := p.brokenRule()
+	// Edits replace p.msg and follow ups are added while holding the lock, so
+	// they're copied here
+	session, msg := p.session, *p.msg
+	followUps := append([]*discordgo.Message{}, p.followUps...)
+	pendingPoliceMutex.Unlock()
+
+	if !broken {
+		return
+	}
+	enforcePoliceRule(session, &msg, r, kind)
+
+	// The follow ups weren't policed on their own, they go with the message
+	if r.action == policeActionDelete {
+		for _, f := range followUps {
+			if err := session.ChannelMessageDelete(f.ChannelID, f.ID); err != nil {
+				log.Printf("Couldn't delete follow up %s of message %s: %s", f.ID, msg.ID, err)
+			}
+		}
+	}
+}
+
+// brokenRule returns the first of the rules the message still breaks,
+// counting the follow ups as part of it.
+func (p *pendingPoliceMessage) brokenRule() (policeRule, policeRuleKind, bool) {
+	combined := *p.msg
+	combined.Attachments = append([]*discordgo.MessageAttachment{}, p.msg.Attachments...)
+	combined.Embeds = append([]*discordgo.MessageEmbed{}, p.msg.Embeds...)
+	for _, f := range p.followUps {
+		combined.Content += "\n" + f.Content
+		combined.Attachments = append(combined.Attachments, f.Attachments...)
+		combined.Embeds = append(combined.Embeds, f.Embeds...)
+	}
+
+	for _, r := range p.rules {
+		if kind, ok := findPoliceRuleKind(r.kind); ok && kind.broken(&combined, p.msg.ChannelID, r.value) {
+			return r, kind, true
+		}
+	}
+	return policeRule{}, policeRuleKind{}, false
+}
+
+// keepIfFixed stops waiting to delete the message once it follows the rules,
+// pendingPoliceMutex has to be held.
+func (p *pendingPoliceMessage) keepIfFixed() {
+	if _, _, broken := p.brokenRule(); broken {
+		return
+	}
+
+	log.Printf("Message (%s) from %s was fixed in time", p.msg.ID, p.msg.Author.String())
+	p.timer.Stop()
+	delete(pendingPoliceMessages, p.msg.ID)
+}
+
+// policeFollowUp counts msg as part of the author's pending messages in the
+// same channel, for people posting their text and then the picture. It
+// reports whether there were any, as msg isn't policed on its own then.
+func policeFollowUp(msg *discordgo.Message) bool {
+	pendingPoliceMutex.Lock()
+	defer pendingPoliceMutex.Unlock()
+
+	merged := false
+	for _, p := range pendingPoliceMessages {
+		if p.msg.ChannelID == msg.ChannelID && p.msg.Author.ID == msg.Author.ID {
+			p.followUps = append(p.followUps, msg)
+			p.keepIfFixed()
+			merged = true
+		}
+	}
+	return merged
+}
+
+// policeMessageUpdate checks pending messages again when they're edited, or
+// when Discord adds the embeds of their links.
+func policeMessageUpdate(s discordSession, m *discordgo.MessageUpdate) {
+	if moduleEnabledByName(m.GuildID, policeModuleName) == false {
+		return
+	}
+
+	pendingPoliceMutex.Lock()
+	defer pendingPoliceMutex.Unlock()
+
+	p, ok := pendingPoliceMessages[m.ID]
+	if !ok {
+		return
+	}
+
+	// Updates only adding embeds may leave out the content
+	updated := *p.msg
+	if len(m.Content) > 0 || m.EditedTimestamp != nil {
+		updated.Content = m.Content
+	}
+	if m.Attachments != nil {
+		updated.Attachments = m.Attachments
+	}
+	if m.Embeds != nil {
+		updated.Embeds = m.Embeds
+	}
+	p.msg = &updated
+	p.keepIfFixed()
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestPoliceFollowUp(t *testing.T) {
+	useTestStorage(t)
+	// Compiled by run otherwise
+	if urlRegex == nil {
+		urlRegex = regexp.MustCompile(urlRegexString)
+	}
+	oldRules := policeRules
+	policeRules = newMemoryPoliceRuleStore()
+	forgetPoliceRules("70")
+	t.Cleanup(func() {
+		policeRules = oldRules
+		forgetPoliceRules("70")
+	})
+
+	for _, r := range []*policeRule{
+		{guildID: "70", channelID: "71", kind: policeRuleLinkOrFile, action: policeActionDelete},
+		{guildID: "70", channelID: "71", kind: policeRuleMinLength, value: "20", action: policeActionDelete},
+	} {
+		if err := policeRules.add(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := guildConfigSet("70", configPoliceGracePeriod, "1h"); err != nil {
+		t.Fatal(err)
+	}
+
+	f := newFakeSession(&discordgo.User{ID: "100"})
+	f.st.GuildAdd(&discordgo.Guild{ID: "70", Name: "guild"})
+	f.st.ChannelAdd(&discordgo.Channel{ID: "71", GuildID: "70", Name: "showcase"})
+	author := &discordgo.User{ID: "72", Username: "author"}
+
+	text := &discordgo.Message{ID: "73", GuildID: "70", ChannelID: "71", Author: author, Content: "Here's the platformer I've been making"}
+	screenshot := &discordgo.Message{ID: "74", GuildID: "70", ChannelID: "71", Author: author,
+		Attachments: []*discordgo.MessageAttachment{{ID: "75", Filename: "game.png"}}}
+
+	msgStreamPoliceHandler(f, &discordgo.MessageCreate{Message: text})
+	pendingPoliceMutex.Lock()
+	_, waiting := pendingPoliceMessages[text.ID]
+	pendingPoliceMutex.Unlock()
+	if !waiting {
+		t.Fatal("text without a picture isn't waiting to be fixed")
+	}
+
+	msgStreamPoliceHandler(f, &discordgo.MessageCreate{Message: screenshot})
+	pendingPoliceMutex.Lock()
+	pending := len(pendingPoliceMessages)
+	pendingPoliceMutex.Unlock()
+	if pending != 0 {
+		t.Errorf("%d messages are still waiting after the screenshot was posted", pending)
+	}
+
+	// Ending the grace periods anyway deletes nothing
+	policeGraceOver(text.ID)
+	policeGraceOver(screenshot.ID)
+	if deletes := f.callsTo("ChannelMessageDelete"); len(deletes) > 0 {
+		t.Errorf("deleted %v", deletes)
+	}
+}
+
+func TestPoliceGraceOver(t *testing.T) {
+	useTestStorage(t)
+
+	f := newFakeSession(&discordgo.User{ID: "100"})
+	f.st.GuildAdd(&discordgo.Guild{ID: "70", Name: "guild"})
+	f.st.ChannelAdd(&discordgo.Channel{ID: "71", GuildID: "70", Name: "showcase"})
+	msg := &discordgo.Message{ID: "76", GuildID: "70", ChannelID: "71", Author: &discordgo.User{ID: "72"}, Content: "short"}
+	rule := policeRule{guildID: "70", channelID: "71", kind: policeRuleMinLength, value: "20", action: policeActionDelete}
+
+	waitForPoliceFix(f, msg, []policeRule{rule}, time.Hour)
+	policeMessageUpdate(f, &discordgo.MessageUpdate{Message: &discordgo.Message{ID: "76", GuildID: "70", ChannelID: "71", Content: "still short"}})
+	policeGraceOver(msg.ID)
+
+	deletes := f.callsTo("ChannelMessageDelete")
+	if len(deletes) != 1 || deletes[0].args[1] != "76" {
+		t.Errorf("deleted %v", deletes)
+	}
+}
+
+func TestPoliceGraceOverFollowUps(t *testing.T) {
+	useTestStorage(t)
+
+	f := newFakeSession(&discordgo.User{ID: "100"})
+	f.st.GuildAdd(&discordgo.Guild{ID: "70", Name: "guild"})
+	f.st.ChannelAdd(&discordgo.Channel{ID: "71", GuildID: "70", Name: "showcase"})
+	author := &discordgo.User{ID: "72"}
+	msg := &discordgo.Message{ID: "77", GuildID: "70", ChannelID: "71", Author: author, Content: "short"}
+
+	tests := []struct {
+		name    string
+		action  string
+		deletes []string
+	}{
+		{name: "delete", action: policeActionDelete, deletes: []string{"77", "78"}},
+		{name: "warn", action: policeActionWarn},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f.calls = nil
+			rule := policeRule{guildID: "70", channelID: "71", kind: policeRuleMinLength, value: "20", action: tt.action}
+			waitForPoliceFix(f, msg, []policeRule{rule}, time.Hour)
+			if !policeFollowUp(&discordgo.Message{ID: "78", GuildID: "70", ChannelID: "71", Author: author, Content: "still"}) {
+				t.Fatal("follow up wasn't merged")
+			}
+			policeGraceOver(msg.ID)
+
+			var deleted []string
+			for _, c := range f.callsTo("ChannelMessageDelete") {
+				deleted = append(deleted, c.args[1].(string))
+			}
+			if !reflect.DeepEqual(deleted, tt.deletes) {
+				t.Errorf("deleted %v, want %v", deleted, tt.deletes)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+)
+
+// policeRule is one requirement messages in a channel have to meet, kind
+// decides what value means and action what happens to messages breaking it.
+type policeRule struct {
+	id        int
+	guildID   string
+	channelID string
+	kind      string
+	value     string
+	action    string
+	// message is sent to the author of a message breaking the rule, the
+	// kind's default is used when it's empty
+	message string
+}
+
+// policeRuleStore keeps the rules of policed channels, and the posts in them
+// for rules limiting how often people can post.
+type policeRuleStore interface {
+	// add stores the rule and sets its ID
+	add(r *policeRule) error
+	// list returns the rules of the guild in the order they were added
+	list(guildID string) ([]policeRule, error)
+	// setMessage returns errNotFound if there is no rule with the ID in the guild
+	setMessage(guildID string, id int, message string) error
+	// remove returns errNotFound if there is no rule with the ID in the guild
+	remove(guildID string, id int) error
+
+	addPost(channelID string, userID string, postedAt time.Time) error
+	// countPosts is how many posts the user made in the channel since then
+	countPosts(channelID string, userID string, since time.Time) (int, error)
+	// prunePosts forgets posts made before then
+	prunePosts(before time.Time) error
+}
+
+type sqlPoliceRuleStore struct {
+	insert      *sql.Stmt
+	query       *sql.Stmt
+	updateMsg   *sql.Stmt
+	delete      *sql.Stmt
+	insertPost  *sql.Stmt
+	queryPosts  *sql.Stmt
+	deletePosts *sql.Stmt
+}
+
+func newSQLPoliceRuleStore(db *storage) *sqlPoliceRuleStore {
+	return &sqlPoliceRuleStore{
+		insert: dbPrepare(db, `INSERT INTO police_rules (guild_id, channel_id, kind, value, action, message)
+			VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`),
+		query:       dbPrepare(db, "SELECT id, channel_id, kind, value, action, message FROM police_rules WHERE guild_id = $1 ORDER BY id"),
+		updateMsg:   dbPrepare(db, "UPDATE police_rules SET message = $3 WHERE guild_id = $1 AND id = $2"),
+		delete:      dbPrepare(db, "DELETE FROM police_rules WHERE guild_id = $1 AND id = $2"),
+		insertPost:  dbPrepare(db, "INSERT INTO police_posts (channel_id, user_id, posted_at) VALUES ($1, $2, $3)"),
+		queryPosts:  dbPrepare(db, "SELECT COUNT(*) FROM police_posts WHERE channel_id = $1 AND user_id = $2 AND posted_at >= $3"),
+		deletePosts: dbPrepare(db, "DELETE FROM police_posts WHERE posted_at < $1"),
+	}
+}
+
+func (s *sqlPoliceRuleStore) add(r *policeRule) error {
+	return s.insert.QueryRow(r.guildID, r.channelID, r.kind, r.value, r.action, r.message).Scan(&r.id)
+}
+
+func (s *sqlPoliceRuleStore) list(guildID string) ([]policeRule, error) {
+	rows, err := s.query.Query(guildID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]policeRule, 0)
+	for rows.Next() {
+		r := policeRule{guildID: guildID}
+		if err := rows.Scan(&r.id, &r.channelID, &r.kind, &r.value, &r.action, &r.message); err != nil {
+			return nil, err
+		}
+		result = append(result, r)
+	}
+	return result, rows.Err()
+}
+
+func (s *sqlPoliceRuleStore) setMessage(guildID string, id int, message string) error {
+	return affectedOrNotFound(s.updateMsg.Exec(guildID, id, message))
+}
+
+func (s *sqlPoliceRuleStore) remove(guildID string, id int) error {
+	return affectedOrNotFound(s.delete.Exec(guildID, id))
+}
+
+func (s *sqlPoliceRuleStore) addPost(channelID string, userID string, postedAt time.Time) error {
+	_, err := s.insertPost.Exec(channelID, userID, postedAt.UTC())
+	return err
+}
+
+func (s *sqlPoliceRuleStore) countPosts(channelID string, userID string, since time.Time) (int, error) {
+	var count int
+	err := s.queryPosts.QueryRow(channelID, userID, since.UTC()).Scan(&count)
+	return count, err
+}
+
+func (s *sqlPoliceRuleStore) prunePosts(before time.Time) error {
+	_, err := s.deletePosts.Exec(before.UTC())
+	return err
+}
+
+// affectedOrNotFound turns statements that changed nothing into errNotFound.
+func affectedOrNotFound(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n <= 0 {
+		return errNotFound
+	}
+	return nil
+}
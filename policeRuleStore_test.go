@@ -0,0 +1,197 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPoliceRuleStore(t *testing.T) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, s policeRuleStore)
+	}{
+		{"rules", func(t *testing.T, s policeRuleStore) {
+			rules := []*policeRule{
+				{guildID: "1", channelID: "10", kind: "min-length", value: "20", action: "delete"},
+				{guildID: "2", channelID: "20", kind: "link-or-file", action: "warn"},
+				{guildID: "1", channelID: "11", kind: "max-posts", value: "2/1d", action: "log", message: "slow down"},
+			}
+			for _, r := range rules {
+				if err := s.add(r); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			list, err := s.list("1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(list) != 2 || list[0] != *rules[0] || list[1] != *rules[2] {
+				t.Fatalf("got %+v", list)
+			}
+
+			if err := s.setMessage("1", rules[0].id, "too short"); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.setMessage("2", rules[0].id, "too short"); err != errNotFound {
+				t.Errorf("changed rule of another guild, err %v", err)
+			}
+			if err := s.remove("2", rules[2].id); err != errNotFound {
+				t.Errorf("removed rule of another guild, err %v", err)
+			}
+			if err := s.remove("1", rules[2].id); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.remove("1", rules[2].id); err != errNotFound {
+				t.Errorf("removed rule twice, err %v", err)
+			}
+
+			list, _ = s.list("1")
+			if len(list) != 1 || list[0].message != "too short" {
+				t.Errorf("got %+v", list)
+			}
+		}},
+		{"posts", func(t *testing.T, s policeRuleStore) {
+			now := time.Now()
+			posts := []struct {
+				channelID string
+				userID    string
+				ago       time.Duration
+			}{
+				{"10", "a", 3 * time.Hour},
+				{"10", "a", time.Hour},
+				{"10", "a", time.Minute},
+				{"10", "b", time.Minute},
+				{"11", "a", time.Minute},
+			}
+			for _, p := range posts {
+				if err := s.addPost(p.channelID, p.userID, now.Add(-p.ago)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if count, err := s.countPosts("10", "a", now.Add(-2*time.Hour)); err != nil || count != 2 {
+				t.Errorf("counted %d posts, err %v", count, err)
+			}
+			if err := s.prunePosts(now.Add(-30 * time.Minute)); err != nil {
+				t.Fatal(err)
+			}
+			if count, _ := s.countPosts("10", "a", now.Add(-24*time.Hour)); count != 1 {
+				t.Errorf("counted %d posts after pruning", count)
+			}
+		}},
+	}
+
+	for _, tt := range tests {
+		stores := map[string]policeRuleStore{
+			"sql":    newSQLPoliceRuleStore(newTestStorage(t)),
+			"memory": newMemoryPoliceRuleStore(),
+		}
+		for name, s := range stores {
+			t.Run(tt.name+"/"+name, func(t *testing.T) { tt.test(t, s) })
+		}
+	}
+}
+
+type policePost struct {
+	channelID string
+	userID    string
+	postedAt  time.Time
+}
+
+type memoryPoliceRuleStore struct {
+	mutex  sync.Mutex
+	nextID int
+	rules  map[int]policeRule
+	posts  []policePost
+}
+
+func newMemoryPoliceRuleStore() *memoryPoliceRuleStore {
+	return &memoryPoliceRuleStore{nextID: 1, rules: make(map[int]policeRule)}
+}
+
+func (s *memoryPoliceRuleStore) add(r *policeRule) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	r.id = s.nextID
+	s.nextID++
+	s.rules[r.id] = *r
+	return nil
+}
+
+func (s *memoryPoliceRuleStore) list(guildID string) ([]policeRule, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	result := make([]policeRule, 0)
+	for _, r := range s.rules {
+		if r.guildID == guildID {
+			result = append(result, r)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].id < result[j].id })
+	return result, nil
+}
+
+func (s *memoryPoliceRuleStore) setMessage(guildID string, id int, message string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	r, ok := s.rules[id]
+	if !ok || r.guildID != guildID {
+		return errNotFound
+	}
+	r.message = message
+	s.rules[id] = r
+	return nil
+}
+
+func (s *memoryPoliceRuleStore) remove(guildID string, id int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	r, ok := s.rules[id]
+	if !ok || r.guildID != guildID {
+		return errNotFound
+	}
+	delete(s.rules, id)
+	return nil
+}
+
+func (s *memoryPoliceRuleStore) addPost(channelID string, userID string, postedAt time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.posts = append(s.posts, policePost{channelID, userID, postedAt.UTC()})
+	return nil
+}
+
+func (s *memoryPoliceRuleStore) countPosts(channelID string, userID string, since time.Time) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	count := 0
+	for _, p := range s.posts {
+		if p.channelID == channelID && p.userID == userID && !p.postedAt.Before(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *memoryPoliceRuleStore) prunePosts(before time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	kept := s.posts[:0]
+	for _, p := range s.posts {
+		if !p.postedAt.Before(before) {
+			kept = append(kept, p)
+		}
+	}
+	s.posts = kept
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestLinkHosts(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{text: "I made this. Hope you like it", want: []string{}},
+		{text: "built with node.js and vue.js", want: []string{}},
+		{text: "v1.2 is out, see the README.md", want: []string{}},
+		{text: "https://github.com/ThisDevDane/vpbot", want: []string{"github.com"}},
+		{text: "Try it at HTTP://Example.COM:8080/demo?x=1 or http://sub.example.org", want: []string{"example.com", "sub.example.org"}},
+		{text: "<https://youtu.be/abc>", want: []string{"youtu.be"}},
+		{text: "(see https://example.com/page)", want: []string{"example.com"}},
+		{text: "ftp://example.com and https://localhost", want: []string{}},
+	}
+
+	for _, tt := range tests {
+		if got := linkHosts(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("linkHosts(%q) is %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestPoliceDomainRules(t *testing.T) {
+	tests := []struct {
+		rule    string
+		value   string
+		content string
+		broken  bool
+	}{
+		{rule: policeRuleAllowedDomains, value: "github.com", content: "I made this. Hope you like it", broken: false},
+		{rule: policeRuleAllowedDomains, value: "github.com", content: "built with node.js", broken: false},
+		{rule: policeRuleAllowedDomains, value: "github.com", content: "https://gist.github.com/x", broken: false},
+		{rule: policeRuleAllowedDomains, value: "github.com", content: "https://gitlab.com/x", broken: true},
+		{rule: policeRuleBlockedDomains, value: "js", content: "built with node.js", broken: false},
+		{rule: policeRuleBlockedDomains, value: "example.com", content: "look https://www.example.com", broken: true},
+	}
+
+	for _, tt := range tests {
+		kind, ok := findPoliceRuleKind(tt.rule)
+		if !ok {
+			t.Fatalf("no %s rule", tt.rule)
+		}
+		msg := &discordgo.Message{Content: tt.content}
+		if got := kind.broken(msg, "1", tt.value); got != tt.broken {
+			t.Errorf("%s %s broken by %q is %t, want %t", tt.rule, tt.value, tt.content, got, tt.broken)
+		}
+	}
+}
+
+func TestMsgStreamPoliceHandler(t *testing.T) {
+	useTestStorage(t)
+	// Compiled by run otherwise
+	if urlRegex == nil {
+		urlRegex = regexp.MustCompile(urlRegexString)
+	}
+	oldRules := policeRules
+	policeRules = newMemoryPoliceRuleStore()
+	forgetPoliceRules("90")
+	t.Cleanup(func() {
+		policeRules = oldRules
+		forgetPoliceRules("90")
+	})
+	err := policeRules.add(&policeRule{guildID: "90", channelID: "91", kind: policeRuleLinkOrFile, action: policeActionDelete})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		msg     *discordgo.Message
+		deleted bool
+	}{
+		{name: "text", msg: &discordgo.Message{ChannelID: "91", Content: "look at this"}, deleted: true},
+		{name: "link", msg: &discordgo.Message{ChannelID: "91", Content: "look at https://example.com/game"}},
+		{name: "file", msg: &discordgo.Message{ChannelID: "91", Content: "look at this",
+			Attachments: []*discordgo.MessageAttachment{{ID: "95", Filename: "game.png"}}}},
+		{name: "other channel", msg: &discordgo.Message{ChannelID: "92", Content: "look at this"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeSession(&discordgo.User{ID: "100"})
+			f.st.GuildAdd(&discordgo.Guild{ID: "90", Name: "guild"})
+			f.st.ChannelAdd(&discordgo.Channel{ID: "91", GuildID: "90", Name: "showcase"})
+			f.st.ChannelAdd(&discordgo.Channel{ID: "92", GuildID: "90", Name: "general"})
+			tt.msg.ID, tt.msg.GuildID, tt.msg.Author = "93", "90", &discordgo.User{ID: "94", Username: "author"}
+
+			msgStreamPoliceHandler(f, &discordgo.MessageCreate{Message: tt.msg})
+
+			deleted := len(f.callsTo("ChannelMessageDelete")) > 0
+			if deleted != tt.deleted {
+				t.Errorf("deleted is %t, want %t", deleted, tt.deleted)
+			}
+			if told := len(f.sentTo("dm-94")) > 0; told != tt.deleted {
+				t.Errorf("author told is %t, want %t", told, tt.deleted)
+			}
+		})
+	}
+}
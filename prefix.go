@@ -0,0 +1,134 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	defaultCommandPrefix = "!"
+	maxCommandPrefixLen  = 5
+)
+
+var (
+	queryGuildPrefix  *sql.Stmt
+	upsertGuildPrefix *sql.Stmt
+
+	guildPrefixMutex sync.RWMutex
+	// guildPrefixCache holds the prefix of every guild looked up so far,
+	// including the ones using the default
+	guildPrefixCache = make(map[string]string)
+)
+
+func initCommandPrefix(db *storage) {
+	queryGuildPrefix = dbPrepare(db, "SELECT prefix FROM guild_prefix WHERE guild_id = $1")
+	upsertGuildPrefix = dbPrepare(db,
+		"INSERT INTO guild_prefix (guild_id, prefix) VALUES ($1, $2) ON CONFLICT (guild_id) DO UPDATE SET prefix = excluded.prefix")
+}
+
+// guildPrefix returns the command prefix used in the guild, DMs always use
+// the default prefix.
+func guildPrefix(guildID string) string {
+	if len(guildID) <= 0 {
+		return defaultCommandPrefix
+	}
+
+	guildPrefixMutex.RLock()
+	prefix, ok := guildPrefixCache[guildID]
+	guildPrefixMutex.RUnlock()
+	if ok {
+		return prefix
+	}
+
+	err := queryGuildPrefix.QueryRow(guildID).Scan(&prefix)
+	if err == sql.ErrNoRows {
+		prefix = defaultCommandPrefix
+	} else if err != nil {
+		// Don't cache, so we try again with the next message
+		log.Printf("Error trying to get the command prefix for guild %s: %s", guildID, err)
+		return defaultCommandPrefix
+	}
+
+	guildPrefixMutex.Lock()
+	guildPrefixCache[guildID] = prefix
+	guildPrefixMutex.Unlock()
+
+	return prefix
+}
+
+func setGuildPrefix(guildID string, prefix string) error {
+	_, err := upsertGuildPrefix.Exec(guildID, prefix)
+	if err != nil {
+		return err
+	}
+
+	guildPrefixMutex.Lock()
+	guildPrefixCache[guildID] = prefix
+	guildPrefixMutex.Unlock()
+
+	return nil
+}
+
+// stripCommandPrefix removes the guild's prefix or a mention of the bot from
+// the start of the message, reporting whether either was there.
+func stripCommandPrefix(s discordSession, m *discordgo.MessageCreate) (content string, mentioned bool, ok bool) {
+	for _, mention := range []string{"<@" + s.state().User.ID + ">", "<@!" + s.state().User.ID + ">"} {
+		if strings.HasPrefix(m.Content, mention) {
+			return strings.TrimSpace(strings.TrimPrefix(m.Content, mention)), true, true
+		}
+	}
+
+	prefix := guildPrefix(m.GuildID)
+	if strings.HasPrefix(m.Content, prefix) {
+		return strings.TrimPrefix(m.Content, prefix), false, true
+	}
+
+	return m.Content, false, false
+}
+
+// prefix is the command prefix of the guild the command was used in.
+func (ctx *commandContext) prefix() string {
+	return guildPrefix(ctx.guildID)
+}
+
+func prefixCommandHandler(ctx *commandContext) {
+	prefix := ctx.args.text("prefix")
+	if ctx.args.flag("reset") {
+		prefix = defaultCommandPrefix
+	} else if ctx.args.has("prefix") == false {
+		ctx.reply(fmt.Sprintf("The current prefix is `%s`, you can also mention me instead of using it", ctx.prefix()))
+		return
+	}
+
+	if len(prefix) <= 0 {
+		ctx.reply("The prefix can't be empty, use --reset to go back to the default")
+		return
+	}
+	if len([]rune(prefix)) > maxCommandPrefixLen {
+		ctx.reply(fmt.Sprintf("The prefix can be at most %d characters long", maxCommandPrefixLen))
+		return
+	}
+	if strings.IndexFunc(prefix, unicode.IsSpace) >= 0 || strings.Contains(prefix, "`") {
+		ctx.reply("The prefix can't contain spaces or backticks")
+		return
+	}
+	if strings.HasPrefix(prefix, "/") {
+		ctx.reply("The prefix can't start with `/`, that's used by slash commands")
+		return
+	}
+
+	if err := setGuildPrefix(ctx.guildID, prefix); err != nil {
+		log.Printf("Error trying to set the command prefix for guild %s: %s", ctx.guildID, err)
+		ctx.reply("Couldn't change the prefix, try again later")
+		return
+	}
+	auditCommand(ctx, auditConfigChanged, "", fmt.Sprintf("Command prefix set to `%s`", prefix))
+
+	ctx.reply(fmt.Sprintf("The prefix is now `%s`", prefix))
+}
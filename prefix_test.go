@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestStripCommandPrefix(t *testing.T) {
+	s := newFakeSession(&discordgo.User{ID: "100"})
+
+	tests := []struct {
+		content   string
+		want      string
+		mentioned bool
+		ok        bool
+	}{
+		{content: "!help math", want: "help math", ok: true},
+		{content: "<@100> help math", want: "help math", mentioned: true, ok: true},
+		{content: "<@!100>help", want: "help", mentioned: true, ok: true},
+		{content: "<@101> help", want: "<@101> help"},
+		{content: "help !math", want: "help !math"},
+	}
+
+	for _, tt := range tests {
+		// DMs always use the default prefix
+		m := &discordgo.MessageCreate{Message: &discordgo.Message{Content: tt.content}}
+		content, mentioned, ok := stripCommandPrefix(s, m)
+		if content != tt.want || mentioned != tt.mentioned || ok != tt.ok {
+			t.Errorf("stripCommandPrefix(%q) is %q, %t, %t, want %q, %t, %t", tt.content, content, mentioned, ok, tt.want, tt.mentioned, tt.ok)
+		}
+	}
+}
+
+func TestPrefixCommandHandler(t *testing.T) {
+	useTestStorage(t)
+	defs := []commandArg{
+		{name: "prefix", kind: argString},
+		{name: "reset", kind: argFlag},
+	}
+
+	tests := []struct {
+		input string
+		reply string
+		want  string
+	}{
+		{input: "", reply: "The current prefix is `!`", want: "!"},
+		{input: `""`, reply: "can't be empty", want: "!"},
+		{input: "toolong", reply: "at most 5 characters", want: "!"},
+		{input: "`", reply: "can't contain spaces or backticks", want: "!"},
+		{input: "/", reply: "can't start with `/`", want: "!"},
+		{input: "?", reply: "The prefix is now `?`", want: "?"},
+		{input: "--reset", reply: "The prefix is now `!`", want: "!"},
+	}
+
+	for _, tt := range tests {
+		f := newFakeSession(&discordgo.User{ID: "100"})
+		m := &discordgo.MessageCreate{Message: &discordgo.Message{GuildID: "50", ChannelID: "51", Author: &discordgo.User{ID: "52"}}}
+		args, err := parseMessageArgs(f, m, defs, tt.input)
+		if err != nil {
+			t.Fatalf("parsing '%s' failed: %s", tt.input, err)
+		}
+
+		prefixCommandHandler(&commandContext{session: f, guildID: "50", channelID: "51", author: m.Author, args: args, message: m})
+
+		replies := f.sentTo("51")
+		if len(replies) != 1 || !strings.Contains(replies[0].Content, tt.reply) {
+			t.Errorf("'%s' replied %+v, want %q", tt.input, replies, tt.reply)
+		}
+		if got := guildPrefix("50"); got != tt.want {
+			t.Errorf("after '%s' the prefix is '%s', want '%s'", tt.input, got, tt.want)
+		}
+	}
+}
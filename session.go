@@ -0,0 +1,119 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// discordSession is the part of the Discord API VPBot uses, handlers depend
+// on it instead of *discordgo.Session so they can run against fakeSession.
+// The methods are the same as on *discordgo.Session.
+type discordSession interface {
+	// state is the cache of guilds, channels, roles and members
+	state() *discordgo.State
+
+	Channel(channelID string, options ...discordgo.RequestOption) (*discordgo.Channel, error)
+	ChannelMessage(channelID string, messageID string, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	ChannelMessageSend(channelID string, content string, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	ChannelMessageEditComplex(m *discordgo.MessageEdit, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	ChannelMessageDelete(channelID string, messageID string, options ...discordgo.RequestOption) error
+	MessageReactionAdd(channelID string, messageID string, emojiID string, options ...discordgo.RequestOption) error
+
+	User(userID string, options ...discordgo.RequestOption) (*discordgo.User, error)
+	UserChannelCreate(recipientID string, options ...discordgo.RequestOption) (*discordgo.Channel, error)
+	UserChannelPermissions(userID string, channelID string, fetchOptions ...discordgo.RequestOption) (int64, error)
+
+	GuildMember(guildID string, userID string, options ...discordgo.RequestOption) (*discordgo.Member, error)
+	GuildBanCreateWithReason(guildID string, userID string, reason string, days int, options ...discordgo.RequestOption) error
+
+	InteractionRespond(interaction *discordgo.Interaction, resp *discordgo.InteractionResponse, options ...discordgo.RequestOption) error
+	FollowupMessageCreate(interaction *discordgo.Interaction, wait bool, data *discordgo.WebhookParams, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	ApplicationCommandBulkOverwrite(appID string, guildID string, commands []*discordgo.ApplicationCommand, options ...discordgo.RequestOption) ([]*discordgo.ApplicationCommand, error)
+
+	UpdateStatusComplex(usd discordgo.UpdateStatusData) error
+}
+
+// liveSession is a discordSession talking to Discord.
+type liveSession struct {
+	*discordgo.Session
+}
+
+func (s liveSession) state() *discordgo.State {
+	return s.State
+}
+
+// stateSession wraps the state of s in a *discordgo.Session for the discordgo
+// helpers that only need the state, like ContentWithMoreMentionsReplaced.
+func stateSession(s discordSession) *discordgo.Session {
+	return &discordgo.Session{State: s.state(), StateEnabled: true}
+}
+
+// addSessionHandler adds an event handler taking a discordSession to the
+// Discord connection.
+func addSessionHandler(d *discordgo.Session, handler interface{}) {
+	s := liveSession{d}
+	switch h := handler.(type) {
+	case func(discordSession, *discordgo.Ready):
+		d.AddHandler(func(_ *discordgo.Session, e *discordgo.Ready) { h(s, e) })
+	case func(discordSession, *discordgo.GuildCreate):
+		d.AddHandler(func(_ *discordgo.Session, e *discordgo.GuildCreate) { h(s, e) })
+	case func(discordSession, *discordgo.GuildMemberAdd):
+		d.AddHandler(func(_ *discordgo.Session, e *discordgo.GuildMemberAdd) { h(s, e) })
+	case func(discordSession, *discordgo.MessageCreate):
+		d.AddHandler(func(_ *discordgo.Session, e *discordgo.MessageCreate) { h(s, e) })
+	case func(discordSession, *discordgo.MessageUpdate):
+		d.AddHandler(func(_ *discordgo.Session, e *discordgo.MessageUpdate) { h(s, e) })
+	case func(discordSession, *discordgo.MessageReactionAdd):
+		d.AddHandler(func(_ *discordgo.Session, e *discordgo.MessageReactionAdd) { h(s, e) })
+	case func(discordSession, *discordgo.MessageReactionRemove):
+		d.AddHandler(func(_ *discordgo.Session, e *discordgo.MessageReactionRemove) { h(s, e) })
+	case func(discordSession, *discordgo.InteractionCreate):
+		d.AddHandler(func(_ *discordgo.Session, e *discordgo.InteractionCreate) { h(s, e) })
+	default:
+		log.Panicf("Unsupported event handler %T", handler)
+	}
+}
+
+// discordURLTransport sends the requests meant for Discord to another
+// server, the path is kept as is.
+type discordURLTransport struct {
+	discordHost string
+	target      *url.URL
+	next        http.RoundTripper
+}
+
+func (t discordURLTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != t.discordHost {
+		return t.next.RoundTrip(req)
+	}
+
+	r := req.Clone(req.Context())
+	r.URL.Scheme = t.target.Scheme
+	r.URL.Host = t.target.Host
+	r.Host = t.target.Host
+	return t.next.RoundTrip(r)
+}
+
+// useDiscordURL makes d talk to the server at target instead of Discord. The
+// gateway is whatever the server returns from /gateway.
+func useDiscordURL(d *discordgo.Session, target string) error {
+	targetURL, err := url.Parse(target)
+	if err != nil {
+		return err
+	}
+	discordEndpoint, err := url.Parse(discordgo.EndpointDiscord)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Using %s instead of Discord", targetURL)
+	d.Client = &http.Client{
+		Timeout:   d.Client.Timeout,
+		Transport: discordURLTransport{discordEndpoint.Host, targetURL, http.DefaultTransport},
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"log"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Discord rejects application commands with descriptions longer than this
+const slashDescriptionLimit = 100
+
+// componentHandlers routes button presses and other message component
+// interactions by the part of their custom ID before the first ':'
+var componentHandlers = make(map[string]func(discordSession, *discordgo.InteractionCreate, []string))
+
+// addComponentHandler makes handler receive the interactions of components
+// with custom IDs like "<prefix>:<arg>:<arg>", the args are passed along.
+func addComponentHandler(prefix string, handler func(discordSession, *discordgo.InteractionCreate, []string)) {
+	if _, ok := componentHandlers[prefix]; ok {
+		log.Fatalf("Tried adding component handler for '%s' when it already has one!", prefix)
+	}
+	componentHandlers[prefix] = handler
+}
+
+// modalHandlers routes modal submissions like componentHandlers, by the part
+// of the modal's custom ID before the first ':'
+var modalHandlers = make(map[string]func(discordSession, *discordgo.InteractionCreate, []string))
+
+func addModalHandler(prefix string, handler func(discordSession, *discordgo.InteractionCreate, []string)) {
+	if _, ok := modalHandlers[prefix]; ok {
+		log.Fatalf("Tried adding modal handler for '%s' when it already has one!", prefix)
+	}
+	modalHandlers[prefix] = handler
+}
+
+// modalValue returns what was entered in the modal's text input with the
+// custom ID.
+func modalValue(data discordgo.ModalSubmitInteractionData, customID string) string {
+	for _, row := range data.Components {
+		actions, ok := row.(*discordgo.ActionsRow)
+		if !ok {
+			continue
+		}
+		for _, c := range actions.Components {
+			if input, ok := c.(*discordgo.TextInput); ok && input.CustomID == customID {
+				return input.Value
+			}
+		}
+	}
+	return ""
+}
+
+// respondEphemeral answers an interaction with a message only the user sees.
+func respondEphemeral(s discordSession, i *discordgo.InteractionCreate, content string) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: content,
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		log.Printf("Couldn't respond to interaction: %s", err)
+	}
+}
+
+// slashGuildCreate registers the slash commands in every guild VPBot is in
+// when connecting, and in guilds it joins later.
+func slashGuildCreate(s discordSession, g *discordgo.GuildCreate) {
+	registerSlashCommands(s, g.ID)
+}
+
+func registerSlashCommands(s discordSession, guildID string) {
+	cmds := make([]*discordgo.ApplicationCommand, 0, len(commandMap))
+	for _, h := range sortedCommands(commandMap) {
+		// Commands without a description are hidden, same as in !help, and so
+		// are commands of disabled modules
+		if len(h.description) <= 0 || moduleEnabled(guildID, h.module) == false {
+			continue
+		}
+
+		cmds = append(cmds, &discordgo.ApplicationCommand{
+			Name:        h.commandString,
+			Description: truncate(h.description, slashDescriptionLimit),
+			Options:     slashCommandOptions(h),
+		})
+	}
+
+	log.Printf("Registering %d slash commands in guild %s...", len(cmds), guildID)
+	_, err := s.ApplicationCommandBulkOverwrite(s.state().User.ID, guildID, cmds)
+	if err != nil {
+		log.Printf("Couldn't register slash commands: %s", err)
+	}
+}
+
+// slashCommandOptions maps subcommands to Discord's subcommand (group)
+// options, Discord only allows two levels of nesting below the command.
+func slashCommandOptions(h *commandHandler) []*discordgo.ApplicationCommandOption {
+	if len(h.subcommands) <= 0 {
+		return slashOptions(h.args)
+	}
+
+	opts := make([]*discordgo.ApplicationCommandOption, 0, len(h.subcommands))
+	for _, sub := range sortedCommands(h.subcommands) {
+		if len(sub.description) <= 0 {
+			continue
+		}
+
+		typ := discordgo.ApplicationCommandOptionSubCommand
+		if len(sub.subcommands) > 0 {
+			typ = discordgo.ApplicationCommandOptionSubCommandGroup
+		}
+
+		opts = append(opts, &discordgo.ApplicationCommandOption{
+			Type:        typ,
+			Name:        sub.commandString,
+			Description: truncate(sub.description, slashDescriptionLimit),
+			Options:     slashCommandOptions(sub),
+		})
+	}
+	return opts
+}
+
+// resolveInteractionSubcommand walks down the subcommand options of an
+// interaction, returning the command invoked and its own options.
+func resolveInteractionSubcommand(cmd *commandHandler, options []*discordgo.ApplicationCommandInteractionDataOption) (*commandHandler, []*discordgo.ApplicationCommandInteractionDataOption) {
+	for len(options) > 0 {
+		opt := options[0]
+		if opt.Type != discordgo.ApplicationCommandOptionSubCommand && opt.Type != discordgo.ApplicationCommandOptionSubCommandGroup {
+			break
+		}
+
+		sub, ok := cmd.subcommands[opt.Name]
+		if !ok {
+			break
+		}
+		cmd, options = sub, opt.Options
+	}
+	return cmd, options
+}
+
+func interactionCreate(s discordSession, i *discordgo.InteractionCreate) {
+	switch i.Type {
+	case discordgo.InteractionApplicationCommand:
+		data := i.ApplicationCommandData()
+		handler, ok := commandMap[data.Name]
+		if !ok {
+			log.Printf("Got slash command /%s which has no handler", data.Name)
+			return
+		}
+
+		handler, options := resolveInteractionSubcommand(handler, data.Options)
+		ctx, err := newInteractionCommandContext(s, i, handler, options)
+		log.Printf("Found /%s command for %s", handler.fullName(), ctx.author.String())
+		if err != nil {
+			replyUsage(ctx, err)
+			return
+		}
+		runCommand(ctx)
+
+	case discordgo.InteractionApplicationCommandAutocomplete:
+		data := i.ApplicationCommandData()
+		handler, ok := commandMap[data.Name]
+		if !ok {
+			return
+		}
+
+		handler, options := resolveInteractionSubcommand(handler, data.Options)
+		if handler.autocomplete == nil {
+			return
+		}
+
+		var focused *discordgo.ApplicationCommandInteractionDataOption
+		for _, opt := range options {
+			if opt.Focused {
+				focused = opt
+			}
+		}
+		if focused == nil {
+			return
+		}
+
+		// The arguments are likely incomplete while the user is typing
+		ctx, _ := newInteractionCommandContext(s, i, handler, options)
+		choices := handler.autocomplete(ctx, focused)
+		err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+			Data: &discordgo.InteractionResponseData{Choices: choices},
+		})
+		if err != nil {
+			log.Printf("Couldn't respond to autocomplete for /%s: %s", handler.fullName(), err)
+		}
+
+	case discordgo.InteractionMessageComponent:
+		parts := strings.Split(i.MessageComponentData().CustomID, ":")
+		handler, ok := componentHandlers[parts[0]]
+		if !ok {
+			log.Printf("Got component interaction %s which has no handler", i.MessageComponentData().CustomID)
+			return
+		}
+		handler(s, i, parts[1:])
+
+	case discordgo.InteractionModalSubmit:
+		parts := strings.Split(i.ModalSubmitData().CustomID, ":")
+		handler, ok := modalHandlers[parts[0]]
+		if !ok {
+			log.Printf("Got modal submission %s which has no handler", i.ModalSubmitData().CustomID)
+			return
+		}
+		handler(s, i, parts[1:])
+	}
+}
+
+func truncate(str string, limit int) string {
+	runes := []rune(str)
+	if len(runes) <= limit {
+		return str
+	}
+	return string(runes[:limit-1]) + "…"
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// dialect holds what differs between the databases VPBot can store its data
+// in. Queries are written for Postgres and translated by the dialect.
+type dialect struct {
+	name       string
+	driverName string
+	// autoIncrement replaces SERIAL PRIMARY KEY in schemas
+	autoIncrement string
+	// placeholder is the prefix of numbered placeholders, $ in $1
+	placeholder string
+}
+
+var (
+	postgresDialect = &dialect{name: "postgres", driverName: "postgres", autoIncrement: "SERIAL PRIMARY KEY", placeholder: "$"}
+	sqliteDialect   = &dialect{name: "sqlite", driverName: "sqlite3", autoIncrement: "INTEGER PRIMARY KEY AUTOINCREMENT", placeholder: "?"}
+
+	placeholderRegex = regexp.MustCompile(`\$(\d+)`)
+)
+
+// storage is the database VPBot keeps its data in, it's used like a *sql.DB
+// but takes care of the dialect differences for queries.
+type storage struct {
+	*sql.DB
+	dialect *dialect
+}
+
+// openStorage connects to the database chosen by the config, either
+// postgres (the default) or sqlite, which stores everything in a single file.
+func openStorage(cfg databaseConfig) (*storage, error) {
+	var store *storage
+	var err error
+	switch cfg.driver {
+	case "postgres", "postgresql":
+		store, err = openStorageWith(postgresDialect, cfg.postgresDSN())
+	case "sqlite", "sqlite3":
+		store, err = openSQLiteStorage(cfg.sqlitePath())
+	default:
+		return nil, fmt.Errorf("unknown database driver '%s', use postgres or sqlite", cfg.driver)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Zero keeps database/sql's defaults
+	if cfg.maxOpenConns > 0 {
+		store.SetMaxOpenConns(cfg.maxOpenConns)
+	}
+	if cfg.maxIdleConns > 0 {
+		store.SetMaxIdleConns(cfg.maxIdleConns)
+	}
+	if cfg.connMaxLifetime > 0 {
+		store.SetConnMaxLifetime(cfg.connMaxLifetime)
+	}
+	return store, nil
+}
+
+// waitForStorage pings the database until it answers, backing off between
+// attempts, so VPBot can start while the database is still coming up.
+func waitForStorage(s *storage, attempts int) error {
+	wait := time.Second
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := s.PingContext(ctx)
+		cancel()
+		if err == nil || attempt >= attempts {
+			return err
+		}
+
+		log.Printf("Couldn't reach the database (attempt %d/%d), trying again in %s: %s", attempt, attempts, wait, err)
+		time.Sleep(wait)
+
+		wait *= 2
+		if wait > 30*time.Second {
+			wait = 30 * time.Second
+		}
+	}
+}
+
+// openSQLiteStorage opens the SQLite database at path, :memory: gives a
+// fresh database that's gone when closed.
+func openSQLiteStorage(path string) (*storage, error) {
+	store, err := openStorageWith(sqliteDialect, "file:"+path+"?_busy_timeout=5000&_journal_mode=WAL")
+	if err != nil {
+		return nil, err
+	}
+
+	// Every connection to :memory: is a database of its own
+	if path == ":memory:" {
+		store.SetMaxOpenConns(1)
+	}
+	return store, nil
+}
+
+func openStorageWith(d *dialect, dsn string) (*storage, error) {
+	conn, err := sql.Open(d.driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &storage{DB: conn, dialect: d}, nil
+}
+
+// rebind turns the $1 style placeholders of query into the ones used by the
+// database.
+func (d *dialect) rebind(query string) string {
+	if d.placeholder == "$" {
+		return query
+	}
+	return placeholderRegex.ReplaceAllString(query, d.placeholder+"$1")
+}
+
+// schema translates Postgres DDL for the database.
+func (d *dialect) schema(ddl string) string {
+	return strings.ReplaceAll(ddl, postgresDialect.autoIncrement, d.autoIncrement)
+}
+
+func (s *storage) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return s.DB.Exec(s.dialect.rebind(query), args...)
+}
+
+func (s *storage) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return s.DB.Query(s.dialect.rebind(query), args...)
+}
+
+func (s *storage) QueryRow(query string, args ...interface{}) *sql.Row {
+	return s.DB.QueryRow(s.dialect.rebind(query), args...)
+}
+
+func (s *storage) Prepare(query string) (*sql.Stmt, error) {
+	return s.DB.Prepare(s.dialect.rebind(query))
+}
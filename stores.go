@@ -0,0 +1,30 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// errNotFound is returned by stores when there is nothing to return
+var errNotFound = errors.New("not found")
+
+// Stores the features use, set up by the modules. Tests can swap them for the
+// memory implementations.
+var (
+	mathSentences mathSentenceStore
+	userTracks    userTrackStore
+	markovModels  markovStore
+	ideas         ideaStore
+	ideaVotes     ideaVoteStore
+	policeRules   policeRuleStore
+	auditLog      auditLogStore
+)
+
+// notFound turns sql.ErrNoRows into errNotFound, so handlers don't have to
+// know which store they're using.
+func notFound(err error) error {
+	if err == sql.ErrNoRows {
+		return errNotFound
+	}
+	return err
+}
@@ -0,0 +1,34 @@
+package main
+
+import "database/sql"
+
+type userTrackStore interface {
+	add(guildID string, week int, year int, userCount int) error
+	// userCount returns errNotFound if nothing was recorded that week
+	userCount(guildID string, week int, year int) (int, error)
+}
+
+type sqlUserTrackStore struct {
+	insert              *sql.Stmt
+	queryByGuildAndWeek *sql.Stmt
+}
+
+func newSQLUserTrackStore(db *storage) *sqlUserTrackStore {
+	return &sqlUserTrackStore{
+		insert: dbPrepare(db,
+			"INSERT INTO user_track_data (guild_id, week_number, year, user_count) VALUES ($1, $2, $3, $4)"),
+		queryByGuildAndWeek: dbPrepare(db,
+			"SELECT user_count FROM user_track_data WHERE guild_id = $1 AND week_number = $2 AND year = $3"),
+	}
+}
+
+func (s *sqlUserTrackStore) add(guildID string, week int, year int, userCount int) error {
+	_, err := s.insert.Exec(guildID, week, year, userCount)
+	return err
+}
+
+func (s *sqlUserTrackStore) userCount(guildID string, week int, year int) (int, error) {
+	var count int
+	err := s.queryByGuildAndWeek.QueryRow(guildID, week, year).Scan(&count)
+	return count, notFound(err)
+}
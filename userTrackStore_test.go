@@ -0,0 +1,87 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestUserTrackStore(t *testing.T) {
+	type count struct {
+		guildID string
+		week    int
+		year    int
+		users   int
+	}
+	tests := []struct {
+		name   string
+		counts []count
+		find   count
+		err    error
+	}{
+		{name: "nothing recorded", find: count{"1", 5, 2026, 0}, err: errNotFound},
+		{name: "found", counts: []count{{"1", 5, 2026, 40}}, find: count{"1", 5, 2026, 40}},
+		{name: "first count of the week", counts: []count{{"1", 5, 2026, 40}, {"1", 5, 2026, 45}}, find: count{"1", 5, 2026, 40}},
+		{name: "other week", counts: []count{{"1", 5, 2026, 40}}, find: count{"1", 6, 2026, 0}, err: errNotFound},
+		{name: "other year", counts: []count{{"1", 5, 2025, 40}}, find: count{"1", 5, 2026, 0}, err: errNotFound},
+		{name: "other guild", counts: []count{{"2", 5, 2026, 40}}, find: count{"1", 5, 2026, 0}, err: errNotFound},
+	}
+
+	for _, tt := range tests {
+		stores := map[string]userTrackStore{
+			"sql":    newSQLUserTrackStore(newTestStorage(t)),
+			"memory": newMemoryUserTrackStore(),
+		}
+		for name, s := range stores {
+			t.Run(tt.name+"/"+name, func(t *testing.T) {
+				for _, c := range tt.counts {
+					if err := s.add(c.guildID, c.week, c.year, c.users); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				got, err := s.userCount(tt.find.guildID, tt.find.week, tt.find.year)
+				if got != tt.find.users || err != tt.err {
+					t.Errorf("got %d, err %v, want %d, err %v", got, err, tt.find.users, tt.err)
+				}
+			})
+		}
+	}
+}
+
+type userTrackKey struct {
+	guildID string
+	week    int
+	year    int
+}
+
+type memoryUserTrackStore struct {
+	mutex  sync.Mutex
+	counts map[userTrackKey]int
+}
+
+func newMemoryUserTrackStore() *memoryUserTrackStore {
+	return &memoryUserTrackStore{counts: make(map[userTrackKey]int)}
+}
+
+func (s *memoryUserTrackStore) add(guildID string, week int, year int, userCount int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	key := userTrackKey{guildID, week, year}
+	// The first count of a week is the one found, same as in the database
+	if _, ok := s.counts[key]; !ok {
+		s.counts[key] = userCount
+	}
+	return nil
+}
+
+func (s *memoryUserTrackStore) userCount(guildID string, week int, year int) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	count, ok := s.counts[userTrackKey{guildID, week, year}]
+	if !ok {
+		return 0, errNotFound
+	}
+	return count, nil
+}
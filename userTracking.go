@@ -1,58 +1,59 @@
 package main
 
 import (
-	"database/sql"
 	"fmt"
 	"log"
-	"os"
 	"time"
 
-	"github.com/bwmarrin/discordgo"
 	"github.com/go-co-op/gocron"
 )
 
-var (
-	userTrackChannel *discordgo.Channel
+const userTrackingModuleName = "usertracking"
 
-	insertUserTrackData              *sql.Stmt
-	queryUserTrackDataByGuildAndDate *sql.Stmt
-)
-
-func initUserTracking(s *discordgo.Session, db *sql.DB, scheduler *gocron.Scheduler) {
-	channelId := os.Getenv("VPBOT_USERTRACK_CHANNEL")
-
-	if len(channelId) > 0 {
-		var err error
-		userTrackChannel, err = s.Channel(channelId)
-
-		if err != nil {
-			log.Printf("Couldn't find the usertrack channel with ID: %s", channelId)
-		}
-	}
+var userTrackingModule = &module{
+	name:           userTrackingModuleName,
+	description:    "Keep track of the user count and post it every week",
+	defaultEnabled: true,
+	setup:          setupUserTrackingModule,
+}
 
-	_, err := db.Exec("CREATE TABLE IF NOT EXISTS user_track_data (id INTEGER PRIMARY KEY, guild_id TEXT, week_number INT, year INT, user_count INT)")
-	if err != nil {
-		log.Panic(err)
-	}
+func setupUserTrackingModule(m *module, db *storage, scheduler *gocron.Scheduler) {
+	initUserTracking(db, scheduler)
+
+	m.addCommand(&commandHandler{
+		commandString: "usercount",
+		description:   "Post the current user count for this guild",
+		category:      "Moderation",
+		modOnly:       true,
+		cooldown:      commandCooldown{channel: 30 * time.Second},
+		handleFunc:    userCountCommandHandler,
+	})
+}
 
-	insertUserTrackData = dbPrepare(db,
-		"INSERT INTO user_track_data (guild_id, week_number, year, user_count) VALUES ($1, $2, $3, $4)")
-	queryUserTrackDataByGuildAndDate = dbPrepare(db,
-		"SELECT user_count FROM user_track_data WHERE guild_id = $1 AND week_number = $2 AND year = $3")
+func initUserTracking(db *storage, scheduler *gocron.Scheduler) {
+	userTracks = newSQLUserTrackStore(db)
 
-	_, err = scheduler.Every(1).Sunday().At("15:00").Do(postUserTrackingInfo)
+	_, err := scheduler.Every(1).Sunday().At("15:00").Do(postUserTrackingInfo)
 	if err != nil {
 		log.Panic(err)
 	}
 }
 
-func userCountCommandHandler(session *discordgo.Session, msg *discordgo.MessageCreate) {
-	guild, _ := session.State.Guild(msg.GuildID)
-	session.ChannelMessageSend(msg.ChannelID, fmt.Sprintf("Current user count: %d", guild.MemberCount))
+func userCountCommandHandler(ctx *commandContext) {
+	guild, _ := ctx.session.state().Guild(ctx.guildID)
+	ctx.reply(fmt.Sprintf("Current user count: %d", guild.MemberCount))
 }
 
 func postUserTrackingInfo() {
-	guild, err := discord.State.Guild(guildID)
+	for _, guildID := range connectedGuildIDs(botSession) {
+		if moduleEnabledByName(guildID, userTrackingModuleName) {
+			postGuildUserTrackingInfo(botSession, guildID)
+		}
+	}
+}
+
+func postGuildUserTrackingInfo(s discordSession, guildID string) {
+	guild, err := s.state().Guild(guildID)
 	if err != nil {
 		log.Println("ERR TRYING TO GET GUILD!", guildID, err)
 		return
@@ -61,12 +62,13 @@ func postUserTrackingInfo() {
 	now := time.Now().UTC()
 	year, week := now.ISOWeek()
 
-	_, err = insertUserTrackData.Exec(guild.ID, week, year, guild.MemberCount)
+	err = userTracks.add(guild.ID, week, year, guild.MemberCount)
 	if err != nil {
 		log.Printf("Error trying to insert user count data: %s", err)
 	}
 
-	if userTrackChannel == nil {
+	userTrackChannelID := guildConfigGet(guildID, configUserTrackChannel)
+	if len(userTrackChannelID) <= 0 {
 		return
 	}
 
@@ -78,12 +80,9 @@ func postUserTrackingInfo() {
 		lastWeek--
 	}
 
-	var lastWeekUserCount int
-
-	row := queryUserTrackDataByGuildAndDate.QueryRow(guild.ID, lastWeek, lastYear)
-	err = row.Scan(&lastWeekUserCount)
-	if err == sql.ErrNoRows {
-		discord.ChannelMessageSend(userTrackChannel.ID, fmt.Sprintf("User count in week %v: %v", week, guild.MemberCount))
+	lastWeekUserCount, err := userTracks.userCount(guild.ID, lastWeek, lastYear)
+	if err == errNotFound {
+		s.ChannelMessageSend(userTrackChannelID, fmt.Sprintf("User count in week %v: %v", week, guild.MemberCount))
 		return
 	}
 
@@ -95,7 +94,7 @@ func postUserTrackingInfo() {
 		symbol = "down"
 	}
 
-	discord.ChannelMessageSend(userTrackChannel.ID,
+	s.ChannelMessageSend(userTrackChannelID,
 		fmt.Sprintf("User count in week %v %v: %v (%s %v%%) (last week: %v)",
 			week,
 			year,